@@ -2,4 +2,5 @@ package api
 
 const ErrCodeUnknownToken = "M_UNKNOWN_TOKEN"
 const ErrCodeUserInUse = "M_USER_IN_USE"
-const ErrCodeNotFound = "M_NOT_FOUND"
\ No newline at end of file
+const ErrCodeNotFound = "M_NOT_FOUND"
+const ErrCodeUnrecognized = "M_UNRECOGNIZED"
@@ -23,7 +23,20 @@ type RoomGuestAccessEventContent struct {
 }
 
 type RoomCreateEventContent struct {
-	CreatorUserId string `json:"creator"`
+	CreatorUserId string                      `json:"creator"`
+	RoomVersion   string                      `json:"room_version,omitempty"`
+	RoomType      string                      `json:"type,omitempty"`
+	Predecessor   *RoomCreatePredecessorEvent `json:"predecessor,omitempty"`
+}
+
+type RoomCreatePredecessorEvent struct {
+	RoomId  string `json:"room_id"`
+	EventId string `json:"event_id"`
+}
+
+type RoomTombstoneEventContent struct {
+	Body              string `json:"body"`
+	ReplacementRoomId string `json:"replacement_room"`
 }
 
 type RoomJoinRulesEventContent struct {
@@ -33,3 +46,45 @@ type RoomJoinRulesEventContent struct {
 type RoomAliasesEventContent struct {
 	Aliases []string `json:"aliases,flow"`
 }
+
+type SpaceChildEventContent struct {
+	Via       []string `json:"via,flow,omitempty"`
+	Order     string   `json:"order,omitempty"`
+	Suggested bool     `json:"suggested,omitempty"`
+}
+
+type SpaceParentEventContent struct {
+	Via       []string `json:"via,flow,omitempty"`
+	Canonical bool     `json:"canonical,omitempty"`
+}
+
+type RoomServerAclEventContent struct {
+	Allow           []string `json:"allow,flow"`
+	Deny            []string `json:"deny,flow"`
+	AllowIpLiterals *bool    `json:"allow_ip_literals,omitempty"`
+}
+
+type RoomCanonicalAliasEventContent struct {
+	Alias string `json:"alias"`
+}
+
+type RoomHistoryVisibilityEventContent struct {
+	Policy string `json:"history_visibility"`
+}
+
+const FormatHtml = "org.matrix.custom.html"
+const RelationTypeReplace = "m.replace"
+
+type RoomMessageEventContent struct {
+	MsgType       string                   `json:"msgtype"`
+	Body          string                   `json:"body"`
+	Format        string                   `json:"format,omitempty"`
+	FormattedBody string                   `json:"formatted_body,omitempty"`
+	NewContent    *RoomMessageEventContent `json:"m.new_content,omitempty"`
+	RelatesTo     *RelatesTo               `json:"m.relates_to,omitempty"`
+}
+
+type RelatesTo struct {
+	RelationType string `json:"rel_type"`
+	EventId      string `json:"event_id"`
+}
@@ -1,5 +1,9 @@
 package api
 
+import (
+	"encoding/json"
+)
+
 type RoomMemberEvent struct {
 	Content  *RoomMemberEventContent `json:"content"`
 	Type     string                  `json:"type"`
@@ -9,3 +13,31 @@ type RoomMemberEvent struct {
 
 	// other fields not included
 }
+
+type StateEvent struct {
+	Content  json.RawMessage `json:"content"`
+	Type     string          `json:"type"`
+	EventId  string          `json:"event_id"`
+	RoomId   string          `json:"room_id"`
+	StateKey string          `json:"state_key"`
+	Sender   string          `json:"sender"`
+
+	// other fields not included
+}
+
+type RoomEvent struct {
+	Content  json.RawMessage    `json:"content"`
+	Type     string             `json:"type"`
+	EventId  string             `json:"event_id"`
+	RoomId   string             `json:"room_id"`
+	Sender   string             `json:"sender"`
+	Unsigned *RoomEventUnsigned `json:"unsigned,omitempty"`
+
+	// other fields not included
+}
+
+type RoomEventUnsigned struct {
+	RedactedBecause json.RawMessage `json:"redacted_because,omitempty"`
+
+	// other fields not included
+}
@@ -10,12 +10,18 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"strconv"
 )
 
 var matrixHttpClient = &http.Client{
 	Timeout: 30 * time.Second,
 }
 
+var matrixMediaHttpClient = &http.Client{
+	// Large uploads and downloads can take a lot longer than a regular request
+	Timeout: 30 * time.Minute,
+}
+
 // Based in part on https://github.com/matrix-org/gomatrix/blob/072b39f7fa6b40257b4eead8c958d71985c28bdd/client.go#L180-L243
 func DoRequest(method string, urlStr string, body interface{}, result interface{}, accessToken string) (error) {
 	var bodyBytes []byte
@@ -31,7 +37,13 @@ func DoRequest(method string, urlStr string, body interface{}, result interface{
 	return doRawRequest(method, urlStr, bodyBytes, "application/json", result, accessToken)
 }
 
-func UploadFile(csApiUrl string, content []byte, name string, mime string, accessToken string) (*ContentUploadResponse, error) {
+// UploadFile uploads the content to the media repository. The uploadLimit is the server's m.upload.size, or 0 if it
+// isn't known, and is checked before anything is sent so we don't stream a large file just to have it rejected.
+func UploadFile(csApiUrl string, content io.Reader, contentLength int64, uploadLimit int64, name string, mime string, accessToken string) (*ContentUploadResponse, error) {
+	if uploadLimit > 0 && contentLength > uploadLimit {
+		return nil, fmt.Errorf("content is %d bytes, which is larger than the server's upload limit of %d bytes", contentLength, uploadLimit)
+	}
+
 	qs := make(map[string]string)
 	if name != "" {
 		qs["filename"] = name
@@ -39,21 +51,57 @@ func UploadFile(csApiUrl string, content []byte, name string, mime string, acces
 	urlStr := MakeUrlQueryString(qs, csApiUrl, "/_matrix/media/r0/upload")
 	log.Println("[DEBUG] Performing upload:", urlStr)
 	result := &ContentUploadResponse{}
-	err := doRawRequest("POST", urlStr, content, mime, result, accessToken)
+	body := &progressReader{reader: content, total: contentLength}
+	err := doStreamRequest(matrixMediaHttpClient, "POST", urlStr, body, contentLength, mime, result, accessToken)
+	return result, err
+}
+
+func GetMediaConfig(csApiUrl string, accessToken string) (*MediaConfigResponse, error) {
+	urlStr := MakeUrl(csApiUrl, "/_matrix/media/r0/config")
+	log.Println("[DEBUG] Getting media config:", urlStr)
+	result := &MediaConfigResponse{}
+	err := DoRequest("GET", urlStr, nil, result, accessToken)
 	return result, err
 }
 
+// MakeDownloadUrl builds the HTTP URL which the given media can be downloaded from
+func MakeDownloadUrl(csApiUrl string, origin string, mediaId string) string {
+	return MakeUrl(csApiUrl, "/_matrix/media/r0/download", origin, mediaId)
+}
+
 func DownloadFile(csApiUrl string, origin string, mediaId string) (*io.ReadCloser, http.Header, error) {
-	urlStr := MakeUrl(csApiUrl, "/_matrix/media/r0/download", origin, mediaId)
+	urlStr := MakeDownloadUrl(csApiUrl, origin, mediaId)
 	log.Println("[DEBUG] Performing download:", urlStr)
+	return doDownloadRequest(urlStr)
+}
+
+// ThumbnailFile downloads a thumbnail of some media. The method is either "crop" or "scale".
+func ThumbnailFile(csApiUrl string, origin string, mediaId string, width int, height int, method string) (*io.ReadCloser, http.Header, error) {
+	qs := map[string]string{
+		"width":  strconv.Itoa(width),
+		"height": strconv.Itoa(height),
+		"method": method,
+	}
+	urlStr := MakeUrlQueryString(qs, csApiUrl, "/_matrix/media/r0/thumbnail", origin, mediaId)
+	log.Println("[DEBUG] Performing thumbnail download:", urlStr)
+	return doDownloadRequest(urlStr)
+}
+
+// DownloadUrl downloads content from any HTTP URL, such as media which is yet to be uploaded to the homeserver
+func DownloadUrl(urlStr string) (*io.ReadCloser, http.Header, error) {
+	log.Println("[DEBUG] Performing download:", urlStr)
+	return doDownloadRequest(urlStr)
+}
+
+func doDownloadRequest(urlStr string) (*io.ReadCloser, http.Header, error) {
 	req, err := http.NewRequest("GET", urlStr, nil)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	res, err := matrixHttpClient.Do(req)
+	res, err := matrixMediaHttpClient.Do(req)
 	if err != nil {
-		return &res.Body, res.Header, err
+		return nil, nil, err
 	}
 
 	if res.StatusCode != http.StatusOK {
@@ -63,19 +111,70 @@ func DownloadFile(csApiUrl string, origin string, mediaId string) (*io.ReadClose
 	return &res.Body, res.Header, nil
 }
 
+// HeadFile gets the headers of some media without downloading it. Servers which don't support HEAD requests are asked
+// for the first byte of the media instead.
+func HeadFile(csApiUrl string, origin string, mediaId string) (http.Header, error) {
+	urlStr := MakeDownloadUrl(csApiUrl, origin, mediaId)
+	log.Println("[DEBUG] Checking media:", urlStr)
+	header, err := doHeadRequest("HEAD", urlStr, nil)
+	if r, ok := err.(*ErrorResponse); ok && (r.StatusCode == http.StatusMethodNotAllowed || r.StatusCode == http.StatusNotImplemented) {
+		log.Println("[DEBUG] Server does not support HEAD requests for media, using a ranged GET instead")
+		header, err = doHeadRequest("GET", urlStr, map[string]string{"Range": "bytes=0-0"})
+	}
+	return header, err
+}
+
+func doHeadRequest(method string, urlStr string, headers map[string]string) (http.Header, error) {
+	log.Println("[DEBUG]", method, urlStr)
+	req, err := http.NewRequest(method, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := matrixHttpClient.Do(req)
+	if res != nil {
+		// The body is never read in full, so the connection is dropped rather than reused
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusPartialContent {
+		contents, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+		mtxErr := &ErrorResponse{}
+		mtxErr.RawError = string(contents)
+		mtxErr.StatusCode = res.StatusCode
+		// HEAD requests have no body, so the status code may be all we get
+		json.Unmarshal(contents, mtxErr)
+		return res.Header, mtxErr
+	}
+
+	return res.Header, nil
+}
+
 func doRawRequest(method string, urlStr string, bodyBytes []byte, contentType string, result interface{}, accessToken string) (error) {
+	return doStreamRequest(matrixHttpClient, method, urlStr, bytes.NewReader(bodyBytes), int64(len(bodyBytes)), contentType, result, accessToken)
+}
+
+func doStreamRequest(client *http.Client, method string, urlStr string, body io.Reader, contentLength int64, contentType string, result interface{}, accessToken string) (error) {
 	log.Println("[DEBUG]", method, urlStr)
-	req, err := http.NewRequest(method, urlStr, bytes.NewBuffer(bodyBytes))
+	req, err := http.NewRequest(method, urlStr, body)
 	if err != nil {
 		return err
 	}
 
+	req.ContentLength = contentLength
 	req.Header.Set("Content-Type", contentType)
 	if accessToken != "" {
 		req.Header.Set("Authorization", "Bearer "+accessToken)
 	}
 
-	res, err := matrixHttpClient.Do(req)
+	res, err := client.Do(req)
 	if res != nil {
 		defer res.Body.Close()
 	}
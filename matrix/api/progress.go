@@ -0,0 +1,29 @@
+package api
+
+import (
+	"io"
+	"log"
+)
+
+// progressReader logs how much of a stream has been read, every 10%
+type progressReader struct {
+	reader      io.Reader
+	total       int64
+	read        int64
+	lastPercent int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	if r.total > 0 {
+		percent := r.read * 100 / r.total
+		if percent/10 > r.lastPercent/10 {
+			log.Printf("[DEBUG] Transferred %d of %d bytes (%d%%)\n", r.read, r.total, percent)
+			r.lastPercent = percent
+		}
+	}
+
+	return n, err
+}
@@ -40,6 +40,7 @@ type CreateRoomRequest struct {
 	InitialState    []CreateRoomStateEvent `json:"initial_state,flow,omitempty"`
 	Preset          string                 `json:"preset,omitempty"`
 	IsDirect        bool                   `json:"is_direct"`
+	RoomVersion     string                 `json:"room_version,omitempty"`
 }
 
 type CreateRoomStateEvent struct {
@@ -52,3 +53,39 @@ type KickRequest struct {
 	UserId string `json:"user_id"`
 	Reason string `json:"reason,omitempty"`
 }
+
+type InviteRequest struct {
+	UserId string `json:"user_id"`
+}
+
+type UnbanRequest struct {
+	UserId string `json:"user_id"`
+}
+
+type RoomUpgradeRequest struct {
+	NewVersion string `json:"new_version"`
+}
+
+type AdminDeleteRoomRequest struct {
+	NewRoomUserId string `json:"new_room_user_id,omitempty"`
+	RoomName      string `json:"room_name,omitempty"`
+	Message       string `json:"message,omitempty"`
+	Block         bool   `json:"block"`
+	Purge         bool   `json:"purge"`
+}
+
+type PublicRoomsRequest struct {
+	Limit                int                `json:"limit,omitempty"`
+	Since                string             `json:"since,omitempty"`
+	Filter               *PublicRoomsFilter `json:"filter,omitempty"`
+	IncludeAllNetworks   bool               `json:"include_all_networks,omitempty"`
+	ThirdPartyInstanceId string             `json:"third_party_instance_id,omitempty"`
+}
+
+type PublicRoomsFilter struct {
+	GenericSearchTerm string `json:"generic_search_term,omitempty"`
+}
+
+type RedactRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
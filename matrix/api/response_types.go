@@ -63,6 +63,10 @@ type ContentUploadResponse struct {
 	ContentMxc string `json:"content_uri"`
 }
 
+type MediaConfigResponse struct {
+	UploadSize int64 `json:"m.upload.size"`
+}
+
 type RoomIdResponse struct {
 	RoomId string `json:"room_id"`
 }
@@ -76,6 +80,65 @@ type RoomDirectoryLookupResponse struct {
 	Servers []string `json:"servers,flow"`
 }
 
+type JoinedRoomsResponse struct {
+	RoomIds []string `json:"joined_rooms,flow"`
+}
+
 type RoomMembersResponse struct {
 	Chunk []RoomMemberEvent `json:"chunk,flow"`
 }
+
+type RoomUpgradeResponse struct {
+	ReplacementRoomId string `json:"replacement_room"`
+}
+
+type CapabilitiesResponse struct {
+	Capabilities struct {
+		RoomVersions *RoomVersionsCapability `json:"m.room_versions"`
+		// other capabilities not included
+	} `json:"capabilities"`
+}
+
+type RoomVersionsCapability struct {
+	Default   string            `json:"default"`
+	Available map[string]string `json:"available"`
+}
+
+type AdminDeleteRoomResponse struct {
+	DeleteId string `json:"delete_id"`
+}
+
+type AdminDeleteRoomStatusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	// shutdown_room is not included
+}
+
+type AdminDeleteMediaResponse struct {
+	DeletedMedia []string `json:"deleted_media"`
+	Total        int      `json:"total"`
+}
+
+type RelationsResponse struct {
+	Chunk     []RoomEvent `json:"chunk,flow"`
+	NextBatch string      `json:"next_batch"`
+}
+
+type PublicRoomsResponse struct {
+	Chunk                  []PublicRoomsChunk `json:"chunk,flow"`
+	NextBatch              string             `json:"next_batch"`
+	PrevBatch              string             `json:"prev_batch"`
+	TotalRoomCountEstimate int                `json:"total_room_count_estimate"`
+}
+
+type PublicRoomsChunk struct {
+	RoomId           string   `json:"room_id"`
+	Aliases          []string `json:"aliases,flow"`
+	CanonicalAlias   string   `json:"canonical_alias"`
+	Name             string   `json:"name"`
+	Topic            string   `json:"topic"`
+	AvatarMxc        string   `json:"avatar_url"`
+	NumJoinedMembers int      `json:"num_joined_members"`
+	WorldReadable    bool     `json:"world_readable"`
+	GuestCanJoin     bool     `json:"guest_can_join"`
+}
@@ -0,0 +1,55 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+)
+
+func dataSourceMediaFile() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceMediaFileRead,
+
+		Schema: dataSourceMediaFileSchema(),
+	}
+}
+
+func dataSourceMediaFileSchema() map[string]*schema.Schema {
+	s := mediaDownloadSchema()
+	s["file_name"] = &schema.Schema{
+		Type:     schema.TypeString,
+		Computed: true,
+	}
+	return s
+}
+
+func dataSourceMediaFileRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	mxc, origin, mediaId, err := stripMxc(d.Get("mxc").(string))
+	if err != nil {
+		return err
+	}
+
+	log.Println("[DEBUG] Downloading media:", mxc)
+	stream, header, err := api.DownloadFile(meta.ClientApiUrl, origin, mediaId)
+	if stream != nil {
+		defer (*stream).Close()
+	}
+	if err != nil {
+		return fmt.Errorf("error downloading media: %s", err)
+	}
+
+	contentType, contentLength, fileName := parseMediaHeaders(header)
+	err = saveMedia(d, *stream, contentLength)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(mxc)
+	d.Set("content_type", contentType)
+	d.Set("file_name", fileName)
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package matrix
+
+import (
+	"testing"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var testAccMatrixMediaFileDataSourceConfig_basic = `
+data "matrix_media_file" "foobar" {
+	mxc = "%s"
+}`
+
+func TestAccMatrixMediaFileDataSource_Basic(t *testing.T) {
+	upload := testAccCreateMatrixContent([]byte("hello world"), "text/plain", "hello.txt")
+	conf := fmt.Sprintf(testAccMatrixMediaFileDataSourceConfig_basic, upload.Mxc)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.matrix_media_file.foobar", "id", upload.Mxc),
+					resource.TestCheckResourceAttr("data.matrix_media_file.foobar", "content_base64", "aGVsbG8gd29ybGQ="),
+					resource.TestCheckResourceAttr("data.matrix_media_file.foobar", "content_length", "11"),
+					resource.TestCheckResourceAttr("data.matrix_media_file.foobar", "content_type", upload.FileType),
+					resource.TestCheckResourceAttr("data.matrix_media_file.foobar", "file_name", upload.FileName),
+					resource.TestCheckResourceAttr("data.matrix_media_file.foobar", "sha256", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"),
+				),
+			},
+		},
+	})
+}
+
+func testUnitMediaFileServer(t *testing.T, contentLength string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/_matrix/media/r0/download/localhost/SomeMedia" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Disposition", `inline; filename="words.txt"`)
+		if contentLength != "" {
+			w.Header().Set("Content-Length", contentLength)
+		} else {
+			// Flushing before writing sends the body chunked, without a Content-Length
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte("hello world"))
+	}))
+}
+
+func TestUnitMediaFileRead_base64(t *testing.T) {
+	server := testUnitMediaFileServer(t, "11")
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, dataSourceMediaFile().Schema, map[string]interface{}{
+		"mxc": "mxc://localhost/SomeMedia",
+	})
+
+	err := dataSourceMediaFileRead(d, Metadata{ClientApiUrl: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if d.Id() != "mxc://localhost/SomeMedia" {
+		t.Errorf("unexpected id: %s", d.Id())
+	}
+	if d.Get("content_base64").(string) != "aGVsbG8gd29ybGQ=" {
+		t.Errorf("unexpected content_base64: %s", d.Get("content_base64"))
+	}
+	if d.Get("content_length").(int) != 11 {
+		t.Errorf("unexpected content_length: %d", d.Get("content_length"))
+	}
+	if d.Get("content_type").(string) != "text/plain" {
+		t.Errorf("unexpected content_type: %s", d.Get("content_type"))
+	}
+	if d.Get("file_name").(string) != "words.txt" {
+		t.Errorf("unexpected file_name: %s", d.Get("file_name"))
+	}
+	if d.Get("sha256").(string) != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected sha256: %s", d.Get("sha256"))
+	}
+}
+
+func TestUnitMediaFileRead_outputPath(t *testing.T) {
+	server := testUnitMediaFileServer(t, "11")
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "terraform-provider-matrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outputPath := filepath.Join(dir, "words.txt")
+
+	d := schema.TestResourceDataRaw(t, dataSourceMediaFile().Schema, map[string]interface{}{
+		"mxc":         "mxc://localhost/SomeMedia",
+		"output_path": outputPath,
+	})
+
+	err = dataSourceMediaFileRead(d, Metadata{ClientApiUrl: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	contents, err := ioutil.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("error reading output file: %s", err)
+	}
+	if string(contents) != "hello world" {
+		t.Errorf("unexpected file contents: %s", string(contents))
+	}
+	if d.Get("content_base64").(string) != "" {
+		t.Errorf("expected no content_base64 when saving to a file, got: %s", d.Get("content_base64"))
+	}
+	if d.Get("sha256").(string) != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected sha256: %s", d.Get("sha256"))
+	}
+}
+
+func TestUnitMediaFileRead_tooLarge(t *testing.T) {
+	cases := []struct {
+		name          string
+		contentLength string
+		outputPath    bool
+	}{
+		{"advertised", "11", false},
+		{"streamed", "", false},
+		{"streamed to file", "", true},
+	}
+
+	for _, c := range cases {
+		server := testUnitMediaFileServer(t, c.contentLength)
+
+		dir, err := ioutil.TempDir("", "terraform-provider-matrix")
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputPath := ""
+		if c.outputPath {
+			outputPath = filepath.Join(dir, "words.txt")
+		}
+
+		d := schema.TestResourceDataRaw(t, dataSourceMediaFile().Schema, map[string]interface{}{
+			"mxc":         "mxc://localhost/SomeMedia",
+			"output_path": outputPath,
+			"max_size":    5,
+		})
+
+		err = dataSourceMediaFileRead(d, Metadata{ClientApiUrl: server.URL})
+		if err == nil || !strings.Contains(err.Error(), "larger than the max_size") {
+			t.Errorf("%s: expected a size error, got: %v", c.name, err)
+		}
+
+		files, _ := ioutil.ReadDir(dir)
+		if len(files) != 0 {
+			t.Errorf("%s: expected no files to be left behind, found %d", c.name, len(files))
+		}
+
+		os.RemoveAll(dir)
+		server.Close()
+	}
+}
@@ -0,0 +1,74 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/hashcode"
+	"github.com/hashicorp/terraform/helper/validation"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"strconv"
+)
+
+func dataSourceMediaThumbnail() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceMediaThumbnailRead,
+
+		Schema: dataSourceMediaThumbnailSchema(),
+	}
+}
+
+func dataSourceMediaThumbnailSchema() map[string]*schema.Schema {
+	s := mediaDownloadSchema()
+	s["width"] = &schema.Schema{
+		Type:         schema.TypeInt,
+		Required:     true,
+		ValidateFunc: validation.IntAtLeast(1),
+	}
+	s["height"] = &schema.Schema{
+		Type:         schema.TypeInt,
+		Required:     true,
+		ValidateFunc: validation.IntAtLeast(1),
+	}
+	s["method"] = &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		Default:      "scale",
+		ValidateFunc: validation.StringInSlice([]string{"crop", "scale"}, false),
+	}
+	return s
+}
+
+func dataSourceMediaThumbnailRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	mxc, origin, mediaId, err := stripMxc(d.Get("mxc").(string))
+	if err != nil {
+		return err
+	}
+	width := d.Get("width").(int)
+	height := d.Get("height").(int)
+	method := d.Get("method").(string)
+
+	log.Println("[DEBUG] Downloading thumbnail:", mxc)
+	stream, header, err := api.ThumbnailFile(meta.ClientApiUrl, origin, mediaId, width, height, method)
+	if stream != nil {
+		defer (*stream).Close()
+	}
+	if err != nil {
+		return fmt.Errorf("error downloading thumbnail: %s", err)
+	}
+
+	contentType, contentLength, _ := parseMediaHeaders(header)
+	err = saveMedia(d, *stream, contentLength)
+	if err != nil {
+		return err
+	}
+
+	// The server may pick a different size than requested, so we identify the thumbnail by the request that produced it
+	id := fmt.Sprintf("%s|%d|%d|%s", mxc, width, height, method)
+	d.SetId(strconv.Itoa(hashcode.String(id)))
+	d.Set("content_type", contentType)
+
+	return nil
+}
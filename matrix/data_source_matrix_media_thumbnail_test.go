@@ -0,0 +1,110 @@
+package matrix
+
+import (
+	"testing"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"bytes"
+	"image"
+	"image/png"
+	"regexp"
+)
+
+var testAccMatrixMediaThumbnailDataSourceConfig_basic = `
+data "matrix_media_thumbnail" "foobar" {
+	mxc = "%s"
+	width = 32
+	height = 32
+	method = "crop"
+}`
+
+func TestAccMatrixMediaThumbnailDataSource_Basic(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 128, 128)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	upload := testAccCreateMatrixContent(buf.Bytes(), "image/png", "square.png")
+	conf := fmt.Sprintf(testAccMatrixMediaThumbnailDataSourceConfig_basic, upload.Mxc)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("data.matrix_media_thumbnail.foobar", "content_base64"),
+					resource.TestMatchResourceAttr("data.matrix_media_thumbnail.foobar", "content_type", regexp.MustCompile("^image/")),
+					resource.TestMatchResourceAttr("data.matrix_media_thumbnail.foobar", "sha256", regexp.MustCompile("^[a-f0-9]{64}$")),
+				),
+			},
+		},
+	})
+}
+
+func TestUnitMediaThumbnailRead_requestsSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/_matrix/media/r0/thumbnail/localhost/SomeMedia" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		q := r.URL.Query()
+		if q.Get("width") != "96" || q.Get("height") != "64" || q.Get("method") != "crop" {
+			t.Errorf("unexpected thumbnail parameters: %s", r.URL.RawQuery)
+		}
+
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, dataSourceMediaThumbnail().Schema, map[string]interface{}{
+		"mxc":    "mxc://localhost/SomeMedia",
+		"width":  96,
+		"height": 64,
+		"method": "crop",
+	})
+
+	err := dataSourceMediaThumbnailRead(d, Metadata{ClientApiUrl: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if d.Id() == "" {
+		t.Errorf("expected an id to be set")
+	}
+	if d.Get("content_type").(string) != "image/png" {
+		t.Errorf("unexpected content_type: %s", d.Get("content_type"))
+	}
+	if d.Get("content_base64").(string) != "aGVsbG8gd29ybGQ=" {
+		t.Errorf("unexpected content_base64: %s", d.Get("content_base64"))
+	}
+	if d.Get("sha256").(string) != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected sha256: %s", d.Get("sha256"))
+	}
+}
+
+func TestUnitMediaThumbnailRead_notFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errcode":"M_NOT_FOUND","error":"Not found"}`))
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, dataSourceMediaThumbnail().Schema, map[string]interface{}{
+		"mxc":    "mxc://localhost/SomeMedia",
+		"width":  32,
+		"height": 32,
+	})
+
+	err := dataSourceMediaThumbnailRead(d, Metadata{ClientApiUrl: server.URL})
+	if err == nil {
+		t.Errorf("expected an error for missing media")
+	}
+}
@@ -0,0 +1,180 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/hashcode"
+	"github.com/hashicorp/terraform/helper/validation"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"strconv"
+)
+
+func dataSourcePublicRooms() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourcePublicRoomsRead,
+
+		Schema: map[string]*schema.Schema{
+			"server": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// Defaults to the homeserver's own directory
+			},
+			"third_party_instance_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"include_all_networks"},
+			},
+			"include_all_networks": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				ConflictsWith: []string{"third_party_instance_id"},
+			},
+			"generic_search_term": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"limit": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Default:      100,
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"access_token": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// Defaults to the provider's default access token
+			},
+			"total_room_count_estimate": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"rooms": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"room_id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"aliases": {
+							Type: schema.TypeList,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+							Computed: true,
+						},
+						"canonical_alias": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"topic": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"avatar_mxc": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"member_count": {
+							Type:     schema.TypeInt,
+							Computed: true,
+						},
+						"world_readable": {
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+						"guest_can_join": {
+							Type:     schema.TypeBool,
+							Computed: true,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourcePublicRoomsRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	server := d.Get("server").(string)
+	searchTerm := d.Get("generic_search_term").(string)
+	limit := d.Get("limit").(int)
+	accessToken := d.Get("access_token").(string)
+	if accessToken == "" {
+		accessToken = meta.DefaultAccessToken
+	}
+
+	request := &api.PublicRoomsRequest{
+		ThirdPartyInstanceId: d.Get("third_party_instance_id").(string),
+		IncludeAllNetworks:   d.Get("include_all_networks").(bool),
+	}
+	if searchTerm != "" {
+		request.Filter = &api.PublicRoomsFilter{GenericSearchTerm: searchTerm}
+	}
+
+	qs := make(map[string]string)
+	if server != "" {
+		qs["server"] = server
+	}
+	urlStr := api.MakeUrlQueryString(qs, meta.ClientApiUrl, "/_matrix/client/r0/publicRooms")
+
+	rooms := make([]interface{}, 0)
+	totalEstimate := 0
+	for len(rooms) < limit {
+		request.Limit = limit - len(rooms)
+
+		response := &api.PublicRoomsResponse{}
+		log.Println("[DEBUG] Getting public rooms:", urlStr)
+		err := api.DoRequest("POST", urlStr, request, response, accessToken)
+		if err != nil {
+			return fmt.Errorf("error getting public rooms: %s", err)
+		}
+
+		totalEstimate = response.TotalRoomCountEstimate
+		for _, chunk := range response.Chunk {
+			if len(rooms) >= limit {
+				break
+			}
+			rooms = append(rooms, flattenPublicRoomsChunk(chunk))
+		}
+
+		if response.NextBatch == "" || len(response.Chunk) == 0 {
+			break
+		}
+		request.Since = response.NextBatch
+	}
+
+	// The directory isn't a single object, so we identify the results by the query that produced them
+	id := fmt.Sprintf("%s|%s|%t|%s|%d", server, request.ThirdPartyInstanceId, request.IncludeAllNetworks, searchTerm, limit)
+	d.SetId(strconv.Itoa(hashcode.String(id)))
+	d.Set("total_room_count_estimate", totalEstimate)
+	d.Set("rooms", rooms)
+
+	return nil
+}
+
+func flattenPublicRoomsChunk(chunk api.PublicRoomsChunk) map[string]interface{} {
+	aliases := make([]interface{}, 0)
+	for _, alias := range chunk.Aliases {
+		aliases = append(aliases, alias)
+	}
+
+	return map[string]interface{}{
+		"room_id":         chunk.RoomId,
+		"aliases":         aliases,
+		"canonical_alias": chunk.CanonicalAlias,
+		"name":            chunk.Name,
+		"topic":           chunk.Topic,
+		"avatar_mxc":      chunk.AvatarMxc,
+		"member_count":    chunk.NumJoinedMembers,
+		"world_readable":  chunk.WorldReadable,
+		"guest_can_join":  chunk.GuestCanJoin,
+	}
+}
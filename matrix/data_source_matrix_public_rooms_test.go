@@ -0,0 +1,115 @@
+package matrix
+
+import (
+	"testing"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"fmt"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+)
+
+var testAccMatrixPublicRoomsDataSourceConfig_search = `
+data "matrix_public_rooms" "foobar" {
+	generic_search_term = "%s"
+}`
+
+func TestAccMatrixPublicRoomsDataSource_Search(t *testing.T) {
+	room := testAccCreateMatrixRoom("Public rooms search target", "mxc://localhost/AvatarHere", "This is a topic", false, "public_chat")
+	request := map[string]string{"visibility": "public"}
+	urlStr := api.MakeUrl(testAccClientServerUrl(), "/_matrix/client/r0/directory/list/room/", room.RoomId)
+	err := api.DoRequest("PUT", urlStr, request, nil, room.CreatorToken)
+	if err != nil {
+		panic(err)
+	}
+
+	conf := fmt.Sprintf(testAccMatrixPublicRoomsDataSourceConfig_search, room.Name)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.matrix_public_rooms.foobar", "rooms.#", "1"),
+					resource.TestCheckResourceAttr("data.matrix_public_rooms.foobar", "rooms.0.room_id", room.RoomId),
+					resource.TestCheckResourceAttr("data.matrix_public_rooms.foobar", "rooms.0.name", room.Name),
+					resource.TestCheckResourceAttr("data.matrix_public_rooms.foobar", "rooms.0.topic", room.Topic),
+					resource.TestCheckResourceAttr("data.matrix_public_rooms.foobar", "rooms.0.member_count", "1"),
+					resource.TestCheckResourceAttr("data.matrix_public_rooms.foobar", "rooms.0.world_readable", "false"),
+				),
+			},
+		},
+	})
+}
+
+func TestUnitPublicRooms_followsPagination(t *testing.T) {
+	requests := make([]api.PublicRoomsRequest, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/_matrix/client/r0/publicRooms" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("server") != "remote.example.org" {
+			t.Errorf("unexpected server parameter: %s", r.URL.Query().Get("server"))
+		}
+
+		request := api.PublicRoomsRequest{}
+		json.NewDecoder(r.Body).Decode(&request)
+		requests = append(requests, request)
+
+		switch request.Since {
+		case "":
+			w.Write([]byte(`{"chunk":[{"room_id":"!a:remote.example.org","aliases":["#a:remote.example.org"],"name":"A","num_joined_members":3},{"room_id":"!b:remote.example.org","name":"B","world_readable":true}],"next_batch":"page2","total_room_count_estimate":5}`))
+		case "page2":
+			w.Write([]byte(`{"chunk":[{"room_id":"!c:remote.example.org","topic":"C"},{"room_id":"!d:remote.example.org"}],"next_batch":"page3","total_room_count_estimate":5}`))
+		default:
+			t.Errorf("requested a page beyond the limit: %s", request.Since)
+			w.Write([]byte(`{"chunk":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, dataSourcePublicRooms().Schema, map[string]interface{}{
+		"server":              "remote.example.org",
+		"generic_search_term": "test",
+		"limit":               3,
+	})
+
+	err := dataSourcePublicRoomsRead(d, Metadata{ClientApiUrl: server.URL})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("unexpected number of requests. expected: %d  got: %d", 2, len(requests))
+	}
+	if requests[0].Limit != 3 || requests[1].Limit != 1 {
+		t.Errorf("unexpected page limits: %d, %d", requests[0].Limit, requests[1].Limit)
+	}
+	if requests[0].Filter == nil || requests[0].Filter.GenericSearchTerm != "test" {
+		t.Errorf("unexpected filter: %#v", requests[0].Filter)
+	}
+
+	rooms := d.Get("rooms").([]interface{})
+	if len(rooms) != 3 {
+		t.Fatalf("unexpected number of rooms. expected: %d  got: %d", 3, len(rooms))
+	}
+	first := rooms[0].(map[string]interface{})
+	if first["room_id"] != "!a:remote.example.org" || first["member_count"] != 3 || len(first["aliases"].([]interface{})) != 1 {
+		t.Errorf("unexpected first room: %#v", first)
+	}
+	if rooms[1].(map[string]interface{})["world_readable"] != true {
+		t.Errorf("expected second room to be world readable")
+	}
+	if rooms[2].(map[string]interface{})["topic"] != "C" {
+		t.Errorf("unexpected third room: %#v", rooms[2])
+	}
+	if d.Get("total_room_count_estimate").(int) != 5 {
+		t.Errorf("unexpected total room count estimate: %d", d.Get("total_room_count_estimate").(int))
+	}
+}
@@ -0,0 +1,167 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"net/url"
+	"sort"
+)
+
+func dataSourceRoom() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceRoomRead,
+
+		Schema: map[string]*schema.Schema{
+			"room_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+			},
+			"alias": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"access_token": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// Defaults to the provider's default access token
+			},
+			"name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"topic": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"avatar_mxc": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"creator_user_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"join_rule": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"canonical_alias": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"world_readable": {
+				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"member_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"servers": {
+				Type: schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceRoomRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	roomIdRaw := nilIfEmptyString(d.Get("room_id"))
+	aliasRaw := nilIfEmptyString(d.Get("alias"))
+	accessToken := d.Get("access_token").(string)
+	if accessToken == "" {
+		accessToken = meta.DefaultAccessToken
+	}
+
+	if roomIdRaw != nil && aliasRaw != nil {
+		return fmt.Errorf("cannot specify both a room_id and alias")
+	}
+	if roomIdRaw == nil && aliasRaw == nil {
+		return fmt.Errorf("a room_id or alias must be specified")
+	}
+
+	var servers []string
+	if aliasRaw != nil {
+		response := &api.RoomDirectoryLookupResponse{}
+		urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/directory/room/", url.QueryEscape(aliasRaw.(string)))
+		log.Println("[DEBUG] Resolving room alias:", urlStr)
+		err := api.DoRequest("GET", urlStr, nil, response, accessToken)
+		if err != nil {
+			return fmt.Errorf("error resolving room alias %s: %s", aliasRaw, err)
+		}
+		roomIdRaw = response.RoomId
+		servers = response.Servers
+	}
+	roomId := roomIdRaw.(string)
+
+	// Non-members can still read the state of world readable rooms
+	state, err := getRoomState(meta, roomId, accessToken)
+	if err != nil {
+		return err
+	}
+
+	nameContent := &api.RoomNameEventContent{}
+	topicContent := &api.RoomTopicEventContent{}
+	avatarContent := &api.RoomAvatarEventContent{}
+	createContent := &api.RoomCreateEventContent{}
+	joinRulesContent := &api.RoomJoinRulesEventContent{}
+	canonicalAliasContent := &api.RoomCanonicalAliasEventContent{}
+	historyVisibilityContent := &api.RoomHistoryVisibilityEventContent{}
+	stateContents := map[string]interface{}{
+		"m.room.name":               nameContent,
+		"m.room.topic":              topicContent,
+		"m.room.avatar":             avatarContent,
+		"m.room.create":             createContent,
+		"m.room.join_rules":         joinRulesContent,
+		"m.room.canonical_alias":    canonicalAliasContent,
+		"m.room.history_visibility": historyVisibilityContent,
+	}
+	for eventType, content := range stateContents {
+		_, err = state.get(eventType, "", content)
+		if err != nil {
+			return err
+		}
+	}
+
+	members, err := state.members("join")
+	if err != nil {
+		return err
+	}
+
+	if servers == nil {
+		// Without a directory lookup, the best we can do is list the servers of the joined members
+		memberServers := make(map[string]bool)
+		for _, userId := range members {
+			if hsDomain, err := getDomainName(userId); err == nil {
+				memberServers[hsDomain] = true
+			}
+		}
+		servers = make([]string, 0)
+		for hsDomain := range memberServers {
+			servers = append(servers, hsDomain)
+		}
+		sort.Strings(servers)
+	}
+
+	d.SetId(roomId)
+	d.Set("room_id", roomId)
+	d.Set("name", nameContent.Name)
+	d.Set("topic", topicContent.Topic)
+	d.Set("avatar_mxc", avatarContent.AvatarMxc)
+	d.Set("creator_user_id", createContent.CreatorUserId)
+	d.Set("join_rule", joinRulesContent.Policy)
+	d.Set("canonical_alias", canonicalAliasContent.Alias)
+	d.Set("world_readable", historyVisibilityContent.Policy == "world_readable")
+	d.Set("member_count", len(members))
+	d.Set("servers", servers)
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package matrix
+
+import (
+	"testing"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"fmt"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+)
+
+var testAccMatrixRoomDataSourceConfig_roomId = `
+data "matrix_room" "foobar" {
+	room_id = "%s"
+}`
+
+func TestAccMatrixRoomDataSource_RoomId(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", false, "private_chat")
+	conf := fmt.Sprintf(testAccMatrixRoomDataSourceConfig_roomId, room.RoomId)
+	hsDomain, err := getDomainName(room.CreatorUserId)
+	if err != nil {
+		panic(err)
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "id", room.RoomId),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "room_id", room.RoomId),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "name", room.Name),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "topic", room.Topic),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "avatar_mxc", room.AvatarMxc),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "creator_user_id", room.CreatorUserId),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "join_rule", "invite"),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "world_readable", "false"),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "member_count", "1"),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "servers.#", "1"),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "servers.0", hsDomain),
+				),
+			},
+		},
+	})
+}
+
+var testAccMatrixRoomDataSourceConfig_alias = `
+data "matrix_room" "foobar" {
+	alias = "%s"
+	access_token = "%s"
+}`
+
+func TestAccMatrixRoomDataSource_AliasWorldReadable(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", false, "public_chat")
+	reader := testAccCreateTestUser("test_acc_room_data_source_reader")
+
+	hsDomain, err := getDomainName(room.CreatorUserId)
+	if err != nil {
+		panic(err)
+	}
+	alias := fmt.Sprintf("#test_acc_room_data_source_alias:%s", hsDomain)
+	testAccCreateRoomAlias(room.RoomId, alias, room.CreatorToken)
+
+	// Make the room world readable so the reader can peek into it without joining
+	visibilityRequest := &api.RoomHistoryVisibilityEventContent{Policy: "world_readable"}
+	urlStr := api.MakeUrl(testAccClientServerUrl(), "/_matrix/client/r0/rooms/", room.RoomId, "/state/m.room.history_visibility")
+	err = api.DoRequest("PUT", urlStr, visibilityRequest, nil, room.CreatorToken)
+	if err != nil {
+		panic(err)
+	}
+
+	conf := fmt.Sprintf(testAccMatrixRoomDataSourceConfig_alias, alias, reader.AccessToken)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "id", room.RoomId),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "name", room.Name),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "join_rule", "public"),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "world_readable", "true"),
+					resource.TestCheckResourceAttr("data.matrix_room.foobar", "servers.#", "1"),
+				),
+			},
+		},
+	})
+}
+
+func TestUnitRoomDataSource_singleStateRequest(t *testing.T) {
+	requests := make(map[string]int)
+	server := testUnitRoomStateServer(t, requests)
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, dataSourceRoom().Schema, map[string]interface{}{
+		"room_id": "!room:localhost",
+	})
+
+	err := dataSourceRoomRead(d, Metadata{ClientApiUrl: server.URL})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if len(requests) != 1 || requests["GET /_matrix/client/r0/rooms/!room:localhost/state"] != 1 {
+		t.Errorf("unexpected requests: %#v", requests)
+	}
+
+	if d.Id() != "!room:localhost" {
+		t.Errorf("unexpected id: %s", d.Id())
+	}
+
+	expected := map[string]string{
+		"name":            "Sample",
+		"creator_user_id": "@alice:localhost",
+		"join_rule":       "public",
+		"world_readable":  "true",
+		"member_count":    "2",
+		"servers":         "[localhost remote.example.org]",
+	}
+	for k, v := range expected {
+		if fmt.Sprintf("%v", d.Get(k)) != v {
+			t.Errorf("unexpected %s. expected: %s  got: %v", k, v, d.Get(k))
+		}
+	}
+}
@@ -0,0 +1,351 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// checksumReader verifies the sha256 of the content as it is read. If the content doesn't match, the read which would
+// complete the content fails instead of returning its bytes, so an upload of the content is aborted rather than finished.
+type checksumReader struct {
+	reader   *bufio.Reader
+	hash     hash.Hash
+	expected string
+}
+
+func newChecksumReader(reader io.Reader, expectedSha256 string) *checksumReader {
+	return &checksumReader{
+		reader:   bufio.NewReader(reader),
+		hash:     sha256.New(),
+		expected: expectedSha256,
+	}
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.hash.Write(p[:n])
+
+	// Look ahead so the last bytes can be held back when the checksum doesn't match
+	if err == nil {
+		if _, peekErr := r.reader.Peek(1); peekErr == io.EOF {
+			err = io.EOF
+		}
+	}
+
+	if err == io.EOF {
+		actual := hex.EncodeToString(r.hash.Sum(nil))
+		if !strings.EqualFold(actual, r.expected) {
+			return 0, fmt.Errorf("checksum mismatch. expected: '%s'  got: '%s'", r.expected, actual)
+		}
+	}
+
+	return n, err
+}
+
+func hashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %s", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %s", err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// detectContentType guesses the type of the content from the file name's extension, falling back to sniffing the
+// leading bytes of the content. The content is not consumed.
+func detectContentType(fileName string, content *bufio.Reader) string {
+	if fileName != "" {
+		if contentType := mime.TypeByExtension(filepath.Ext(fileName)); contentType != "" {
+			return contentType
+		}
+	}
+
+	// Peek returns whatever is available when the content is shorter than requested, alongside an error we don't need
+	leading, _ := content.Peek(512)
+	return http.DetectContentType(leading)
+}
+
+// parseMediaHeaders reads the type, size, and name of some media from the headers of its download response. Responses
+// to ranged requests describe the total size in the Content-Range rather than the Content-Length.
+func parseMediaHeaders(header http.Header) (string, int64, string) {
+	contentType := header.Get("Content-Type")
+
+	var contentLength int64
+	if contentRange := header.Get("Content-Range"); contentRange != "" {
+		// Format: bytes 0-0/12345
+		if i := strings.LastIndex(contentRange, "/"); i >= 0 {
+			contentLength, _ = strconv.ParseInt(contentRange[i+1:], 10, 64)
+		}
+	} else {
+		contentLength, _ = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	}
+
+	fileName := ""
+	if disposition := header.Get("Content-Disposition"); disposition != "" {
+		_, params, err := mime.ParseMediaType(disposition)
+		if err != nil {
+			log.Println("[WARN] Unable to parse Content-Disposition:", err)
+		} else {
+			fileName = params["filename"]
+		}
+	}
+
+	return contentType, contentLength, fileName
+}
+
+// mediaDownloadSchema is the schema shared by data sources which download media with saveMedia
+func mediaDownloadSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"mxc": {
+			Type:         schema.TypeString,
+			Required:     true,
+			ValidateFunc: validateMxc,
+		},
+		"output_path": {
+			Type:     schema.TypeString,
+			Optional: true,
+			// The media is exposed as content_base64 when not given
+		},
+		"max_size": {
+			Type:         schema.TypeInt,
+			Optional:     true,
+			Default:      10 * 1024 * 1024,
+			ValidateFunc: validation.IntAtLeast(1),
+		},
+		"content_base64": {
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"content_type": {
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"content_length": {
+			Type:     schema.TypeInt,
+			Computed: true,
+		},
+		"sha256": {
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+	}
+}
+
+// saveMedia reads downloaded media into the resource's output_path, or into its content_base64 when no path is given.
+// Media larger than the max_size is rejected, and the sha256 and content_length of the media are set. The advertised
+// length is checked first so we don't start downloading media we can't keep, but the media may not have one.
+func saveMedia(d *schema.ResourceData, content io.Reader, advertisedLength int64) error {
+	maxSize := int64(d.Get("max_size").(int))
+	outputPath := d.Get("output_path").(string)
+
+	if advertisedLength > maxSize {
+		return fmt.Errorf("media is larger than the max_size of %d bytes", maxSize)
+	}
+
+	// Read one byte past the limit so we can tell when the media is too large
+	hash := sha256.New()
+	limited := io.TeeReader(io.LimitReader(content, maxSize+1), hash)
+
+	var size int64
+	if outputPath != "" {
+		// Write to a temporary file first so a failed download doesn't leave a partial file behind
+		f, err := ioutil.TempFile(filepath.Dir(outputPath), ".matrix-media-")
+		if err != nil {
+			return fmt.Errorf("error creating file: %s", err)
+		}
+		defer os.Remove(f.Name())
+
+		size, err = io.Copy(f, limited)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("error downloading media: %s", err)
+		}
+		if size > maxSize {
+			return fmt.Errorf("media is larger than the max_size of %d bytes", maxSize)
+		}
+
+		err = os.Chmod(f.Name(), 0644)
+		if err != nil {
+			return fmt.Errorf("error writing file: %s", err)
+		}
+		err = os.Rename(f.Name(), outputPath)
+		if err != nil {
+			return fmt.Errorf("error writing file: %s", err)
+		}
+		log.Println("[DEBUG] Saved media to:", outputPath)
+	} else {
+		contents, err := ioutil.ReadAll(limited)
+		if err != nil {
+			return fmt.Errorf("error downloading media: %s", err)
+		}
+		size = int64(len(contents))
+		if size > maxSize {
+			return fmt.Errorf("media is larger than the max_size of %d bytes", maxSize)
+		}
+		d.Set("content_base64", base64.StdEncoding.EncodeToString(contents))
+	}
+
+	d.Set("sha256", hex.EncodeToString(hash.Sum(nil)))
+	d.Set("content_length", size)
+	return nil
+}
+
+// getUploadLimit returns the homeserver's upload limit, or 0 if it isn't known
+func getUploadLimit(meta Metadata, accessToken string) int64 {
+	config, err := api.GetMediaConfig(meta.ClientApiUrl, accessToken)
+	if err != nil {
+		log.Println("[WARN] Unable to get media config, skipping upload size check:", err)
+		return 0
+	}
+	return config.UploadSize
+}
+
+// spoolMedia writes the content to a temporary file so its length is known before it is uploaded. Content larger than
+// the upload limit (if known) is rejected without being read in full. The caller is responsible for removing the file.
+func spoolMedia(content io.Reader, maxSize int64) (*os.File, int64, error) {
+	f, err := ioutil.TempFile("", "terraform-provider-matrix-")
+	if err != nil {
+		return nil, 0, fmt.Errorf("error creating temporary file: %s", err)
+	}
+
+	// Read one byte past the limit so we can tell when the content is too large
+	limited := content
+	if maxSize > 0 {
+		limited = io.LimitReader(content, maxSize+1)
+	}
+	size, err := io.Copy(f, limited)
+	if err != nil {
+		return f, 0, err
+	}
+	if maxSize > 0 && size > maxSize {
+		return f, 0, fmt.Errorf("content is larger than the server's upload limit of %d bytes", maxSize)
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return f, 0, err
+	}
+
+	log.Printf("[DEBUG] Downloaded %d bytes to %s\n", size, f.Name())
+	return f, size, nil
+}
+
+// uploadMedia uploads the content, returning the upload result and the sha256 of the content. The content is hashed as
+// it is uploaded so it only needs to be read once.
+func uploadMedia(meta Metadata, content io.Reader, contentLength int64, uploadLimit int64, fileName string, contentType string, accessToken string) (*api.ContentUploadResponse, string, error) {
+	hash := sha256.New()
+	result, err := api.UploadFile(meta.ClientApiUrl, io.TeeReader(content, hash), contentLength, uploadLimit, fileName, contentType, accessToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return result, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// uploadAvatarFile uploads the resource's avatar_file, returning the new mxc URI
+func uploadAvatarFile(d *schema.ResourceData, meta Metadata, accessToken string) (string, error) {
+	filePath := d.Get("avatar_file").(string)
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("error opening avatar file: %s", err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("error reading avatar file: %s", err)
+	}
+
+	content := bufio.NewReader(f)
+	contentType := d.Get("avatar_file_type").(string)
+	if contentType == "" {
+		contentType = detectContentType(filePath, content)
+	}
+
+	log.Println("[DEBUG] Uploading avatar file:", filePath)
+	result, hash, err := uploadMedia(meta, content, stat.Size(), getUploadLimit(meta, accessToken), filepath.Base(filePath), contentType, accessToken)
+	if err != nil {
+		return "", fmt.Errorf("error uploading avatar: %s", err)
+	}
+
+	d.Set("avatar_file_sha256", hash)
+	d.Set("avatar_mxc", result.ContentMxc)
+	return result.ContentMxc, nil
+}
+
+// avatarFileChanged reports whether the avatar_file needs to be uploaded again
+func avatarFileChanged(d *schema.ResourceData) bool {
+	if d.Get("avatar_file").(string) == "" {
+		return false
+	}
+	return d.HasChange("avatar_file_sha256") || d.HasChange("avatar_file_type")
+}
+
+// customizeDiffAvatarFile plans a new upload when the contents or type of the avatar_file change, and removes the
+// uploaded avatar when the avatar_file is removed
+func customizeDiffAvatarFile(d *schema.ResourceDiff) error {
+	filePath := d.Get("avatar_file").(string)
+	if !d.NewValueKnown("avatar_file") {
+		err := d.SetNewComputed("avatar_file_sha256")
+		if err != nil {
+			return err
+		}
+		return d.SetNewComputed("avatar_mxc")
+	}
+	if filePath == "" {
+		if d.Get("avatar_file_sha256").(string) == "" {
+			return nil
+		}
+
+		log.Println("[DEBUG] Avatar file removed, planning avatar removal")
+		err := d.SetNew("avatar_file_sha256", "")
+		if err != nil {
+			return err
+		}
+		if d.HasChange("avatar_mxc") {
+			// The avatar_mxc is being set instead
+			return nil
+		}
+		return d.SetNew("avatar_mxc", "")
+	}
+
+	hash, err := hashFile(filePath)
+	if err != nil {
+		return fmt.Errorf("error hashing avatar file: %s", err)
+	}
+
+	if hash != d.Get("avatar_file_sha256").(string) || d.HasChange("avatar_file_type") {
+		log.Println("[DEBUG] Avatar file changed, planning upload:", filePath)
+		err = d.SetNew("avatar_file_sha256", hash)
+		if err != nil {
+			return err
+		}
+		return d.SetNewComputed("avatar_mxc")
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+package matrix
+
+import (
+	"testing"
+	"bufio"
+	"github.com/hashicorp/terraform/helper/schema"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"encoding/json"
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"reflect"
+	"io"
+)
+
+func testUnitWriteTempFile(t *testing.T, name string, content string) string {
+	dir, err := ioutil.TempDir("", "terraform-provider-matrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(dir, name)
+	err = ioutil.WriteFile(filePath, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return filePath
+}
+
+func TestUnitMediaHashFile(t *testing.T) {
+	filePath := testUnitWriteTempFile(t, "words.txt", "hello world")
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	hash, err := hashFile(filePath)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if hash != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected hash: %s", hash)
+	}
+}
+
+func TestUnitMediaUploadAvatarFile_usesOwnToken(t *testing.T) {
+	filePath := testUnitWriteTempFile(t, "avatar.png", "not really a png")
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/_matrix/media/r0/config" {
+			w.Write([]byte(`{"m.upload.size":1024}`))
+			return
+		}
+		if r.Method != "POST" || r.URL.Path != "/_matrix/media/r0/upload" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer member_token" {
+			t.Errorf("unexpected authorization header: %s", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("Content-Type") != "image/png" {
+			t.Errorf("unexpected content type: %s", r.Header.Get("Content-Type"))
+		}
+		if r.ContentLength != int64(len("not really a png")) {
+			t.Errorf("unexpected content length: %d", r.ContentLength)
+		}
+		if r.URL.Query().Get("filename") != "avatar.png" {
+			t.Errorf("unexpected file name: %s", r.URL.Query().Get("filename"))
+		}
+		w.Write([]byte(`{"content_uri":"mxc://localhost/avatar"}`))
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceUser().Schema, map[string]interface{}{
+		"access_token": "member_token",
+		"avatar_file":  filePath,
+	})
+
+	avatarMxc, err := uploadAvatarFile(d, Metadata{ClientApiUrl: server.URL, DefaultAccessToken: "default_token"}, "member_token")
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if avatarMxc != "mxc://localhost/avatar" || d.Get("avatar_mxc").(string) != avatarMxc {
+		t.Errorf("unexpected avatar mxc: %s", avatarMxc)
+	}
+	if d.Get("avatar_file_sha256").(string) != "e90137d39de304eefbbe788bc535c7e82f27abbf8069505fbbd8a9dcdc4f2024" {
+		t.Errorf("unexpected avatar hash: %s", d.Get("avatar_file_sha256"))
+	}
+}
+
+func TestUnitMediaUploadAvatarFile_tooLarge(t *testing.T) {
+	filePath := testUnitWriteTempFile(t, "avatar.png", "this file is larger than the limit")
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" && r.URL.Path == "/_matrix/media/r0/config" {
+			w.Write([]byte(`{"m.upload.size":8}`))
+			return
+		}
+		t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceUser().Schema, map[string]interface{}{
+		"access_token": "member_token",
+		"avatar_file":  filePath,
+	})
+
+	_, err := uploadAvatarFile(d, Metadata{ClientApiUrl: server.URL}, "member_token")
+	if err == nil || !strings.Contains(err.Error(), "upload limit") {
+		t.Errorf("expected an upload limit error, got: %v", err)
+	}
+}
+
+func TestUnitMediaDetectContentType(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+	cases := []struct {
+		fileName string
+		content  string
+		expected string
+	}{
+		{"logo.svg", "<svg></svg>", "image/svg+xml"},
+		{"", png, "image/png"},
+		{"no_extension", png, "image/png"},
+		{"unknown.notarealextension", "hello world", "text/plain; charset=utf-8"},
+		{"", "", "text/plain; charset=utf-8"},
+	}
+
+	for _, c := range cases {
+		content := bufio.NewReader(strings.NewReader(c.content))
+		contentType := detectContentType(c.fileName, content)
+		if contentType != c.expected {
+			t.Errorf("unexpected type for %q. expected: %s  got: %s", c.fileName, c.expected, contentType)
+		}
+
+		// Detecting the type must not consume the content
+		remaining, _ := ioutil.ReadAll(content)
+		if string(remaining) != c.content {
+			t.Errorf("content was consumed while detecting the type of %q", c.fileName)
+		}
+	}
+}
+
+func testUnitAvatarProfileServer(t *testing.T, uploadTypes *[]string, avatarMxc *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/_matrix/media/r0/config":
+			w.Write([]byte(`{}`))
+		case r.Method == "POST" && r.URL.Path == "/_matrix/media/r0/upload":
+			*uploadTypes = append(*uploadTypes, r.Header.Get("Content-Type"))
+			w.Write([]byte(`{"content_uri":"mxc://localhost/uploaded"}`))
+		case r.Method == "PUT" && r.URL.Path == "/_matrix/client/r0/profile/@alice:localhost/avatar_url":
+			request := &api.ProfileAvatarUrlRequest{}
+			json.NewDecoder(r.Body).Decode(request)
+			*avatarMxc = request.AvatarMxc
+			w.Write([]byte(`{}`))
+		case r.Method == "GET" && r.URL.Path == "/_matrix/client/r0/profile/@alice:localhost":
+			json.NewEncoder(w).Encode(&api.ProfileResponse{AvatarMxc: *avatarMxc})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestUnitMediaAvatarFile_typeChangeUploadsAgain(t *testing.T) {
+	filePath := testUnitWriteTempFile(t, "avatar.png", "not really a png")
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	var uploadTypes []string
+	avatarMxc := "mxc://localhost/original"
+	server := testUnitAvatarProfileServer(t, &uploadTypes, &avatarMxc)
+	defer server.Close()
+	meta := Metadata{ClientApiUrl: server.URL}
+
+	state := &terraform.InstanceState{
+		ID: "@alice:localhost",
+		Attributes: map[string]string{
+			"access_token":       "alice_token",
+			"avatar_mxc":         "mxc://localhost/original",
+			"avatar_file":        filePath,
+			"avatar_file_sha256": "e90137d39de304eefbbe788bc535c7e82f27abbf8069505fbbd8a9dcdc4f2024",
+		},
+	}
+	rawConfig, err := config.NewRawConfig(map[string]interface{}{
+		"access_token":     "alice_token",
+		"avatar_file":      filePath,
+		"avatar_file_type": "image/webp",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := resourceUser().Diff(state, terraform.NewResourceConfig(rawConfig), meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff == nil || diff.Attributes["avatar_mxc"] == nil || !diff.Attributes["avatar_mxc"].NewComputed {
+		t.Fatalf("expected a new avatar to be planned, got: %#v", diff)
+	}
+
+	newState, err := resourceUser().Apply(state, diff, meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(uploadTypes, []string{"image/webp"}) {
+		t.Errorf("unexpected uploads: %v", uploadTypes)
+	}
+	if newState.Attributes["avatar_mxc"] != "mxc://localhost/uploaded" {
+		t.Errorf("unexpected avatar mxc: %s", newState.Attributes["avatar_mxc"])
+	}
+}
+
+func TestUnitMediaAvatarFile_removedClearsAvatar(t *testing.T) {
+	filePath := testUnitWriteTempFile(t, "avatar.png", "not really a png")
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	var uploadTypes []string
+	avatarMxc := "mxc://localhost/original"
+	server := testUnitAvatarProfileServer(t, &uploadTypes, &avatarMxc)
+	defer server.Close()
+	meta := Metadata{ClientApiUrl: server.URL}
+
+	state := &terraform.InstanceState{
+		ID: "@alice:localhost",
+		Attributes: map[string]string{
+			"access_token":       "alice_token",
+			"avatar_mxc":         "mxc://localhost/original",
+			"avatar_file":        filePath,
+			"avatar_file_sha256": "e90137d39de304eefbbe788bc535c7e82f27abbf8069505fbbd8a9dcdc4f2024",
+		},
+	}
+	rawConfig, err := config.NewRawConfig(map[string]interface{}{
+		"access_token": "alice_token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := resourceUser().Diff(state, terraform.NewResourceConfig(rawConfig), meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	newState, err := resourceUser().Apply(state, diff, meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(uploadTypes) != 0 {
+		t.Errorf("unexpected uploads: %v", uploadTypes)
+	}
+	if avatarMxc != "" {
+		t.Errorf("expected the avatar to be removed, got: %s", avatarMxc)
+	}
+	if newState.Attributes["avatar_mxc"] != "" || newState.Attributes["avatar_file_sha256"] != "" {
+		t.Errorf("expected the avatar to be cleared from state, got: %#v", newState.Attributes)
+	}
+}
+
+type testUnitUnreadableReader struct {
+	t *testing.T
+}
+
+func (r testUnitUnreadableReader) Read(p []byte) (int, error) {
+	r.t.Errorf("media was read despite its advertised length")
+	return 0, io.EOF
+}
+
+func TestUnitMediaSaveMedia_advertisedLengthTooLarge(t *testing.T) {
+	for name, resource := range map[string]*schema.Resource{"file": dataSourceMediaFile(), "thumbnail": dataSourceMediaThumbnail()} {
+		d := schema.TestResourceDataRaw(t, resource.Schema, map[string]interface{}{
+			"mxc":      "mxc://localhost/media",
+			"max_size": 5,
+		})
+
+		err := saveMedia(d, testUnitUnreadableReader{t}, 6)
+		if err == nil || !strings.Contains(err.Error(), "larger than the max_size") {
+			t.Errorf("%s: expected a max_size error, got: %v", name, err)
+		}
+	}
+}
@@ -3,4 +3,5 @@ package matrix
 type Metadata struct {
 	ClientApiUrl       string
 	DefaultAccessToken string
+	AdminAccessToken   string
 }
@@ -20,12 +20,30 @@ func Provider() terraform.ResourceProvider {
 				DefaultFunc: schema.EnvDefaultFunc("MATRIX_DEFAULT_ACCESS_TOKEN", ""),
 				Description: "The default access token to use for miscellaneous requests (media uploads, etc)",
 			},
+			"admin_access_token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("MATRIX_ADMIN_ACCESS_TOKEN", ""),
+				Description: "The access token of a server admin, used for admin APIs (purging rooms, etc)",
+			},
 		},
 
 		ResourcesMap: map[string]*schema.Resource{
-			"matrix_user":    resourceUser(),
-			"matrix_content": resourceContent(),
-			"matrix_room":    resourceRoom(),
+			"matrix_user":             resourceUser(),
+			"matrix_content":          resourceContent(),
+			"matrix_room":             resourceRoom(),
+			"matrix_room_member":      resourceRoomMember(),
+			"matrix_room_members":     resourceRoomMembers(),
+			"matrix_room_state_event": resourceRoomStateEvent(),
+			"matrix_space_child":      resourceSpaceChild(),
+			"matrix_message":          resourceMessage(),
+		},
+
+		DataSourcesMap: map[string]*schema.Resource{
+			"matrix_room":            dataSourceRoom(),
+			"matrix_public_rooms":    dataSourcePublicRooms(),
+			"matrix_media_file":      dataSourceMediaFile(),
+			"matrix_media_thumbnail": dataSourceMediaThumbnail(),
 		},
 
 		ConfigureFunc: providerConfigure,
@@ -36,6 +54,7 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	config := Metadata{
 		ClientApiUrl:       d.Get("client_server_url").(string),
 		DefaultAccessToken: d.Get("default_access_token").(string),
+		AdminAccessToken:   d.Get("admin_access_token").(string),
 	}
 
 	return config, nil
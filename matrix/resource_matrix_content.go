@@ -2,12 +2,19 @@ package matrix
 
 import (
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
 	"fmt"
 	"github.com/turt2live/terraform-provider-matrix/matrix/api"
 	"io"
-	"io/ioutil"
+	"net/http"
 	"os"
 	"log"
+	"encoding/base64"
+	"bytes"
+	"bufio"
+	"strings"
+	"net/url"
+	"regexp"
 )
 
 func resourceContent() *schema.Resource {
@@ -15,9 +22,15 @@ func resourceContent() *schema.Resource {
 		Exists: resourceContentExists,
 		Create: resourceContentCreate,
 		Read:   resourceContentRead,
-		//Update: resourceContentUpdate, // We can't update media, and everything is ForceNew
+		Update: resourceContentUpdate, // We can't update media, so only the destroy options can change
 		Delete: resourceContentDelete,
 
+		CustomizeDiff: resourceContentCustomizeDiff,
+
+		Importer: &schema.ResourceImporter{
+			State: resourceContentImport,
+		},
+
 		Schema: map[string]*schema.Schema{
 			"origin": {
 				Type:     schema.TypeString,
@@ -32,9 +45,36 @@ func resourceContent() *schema.Resource {
 				ForceNew: true,
 			},
 			"file_path": {
-				Type:     schema.TypeString,
-				Optional: true,
-				ForceNew: true,
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"content", "content_base64", "source_url"},
+			},
+			"content": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"file_path", "content_base64", "source_url"},
+			},
+			"content_base64": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"file_path", "content", "source_url"},
+				ValidateFunc:  validateBase64,
+			},
+			"source_url": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ForceNew:      true,
+				ConflictsWith: []string{"file_path", "content", "content_base64"},
+			},
+			"source_sha256": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.StringMatch(regexp.MustCompile("^[a-fA-F0-9]{64}$"), "must be a sha256 hash in hex"),
+				// Checked while the source_url is uploaded
 			},
 			"file_type": {
 				Type:     schema.TypeString,
@@ -44,7 +84,43 @@ func resourceContent() *schema.Resource {
 			"file_name": {
 				Type:     schema.TypeString,
 				Optional: true,
+				Computed: true,
+				ForceNew: true,
+				// Read from the download response when not given
+			},
+			"detected_file_type": {
+				Type:     schema.TypeString,
+				Computed: true,
+				// The file_type takes precedence when uploading
+			},
+			"content_type": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"content_length": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"http_url": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"delete_on_destroy": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				ConflictsWith: []string{"quarantine_on_destroy"},
+				// Only local media can be deleted
+			},
+			"quarantine_on_destroy": {
+				Type:          schema.TypeBool,
+				Optional:      true,
+				ConflictsWith: []string{"delete_on_destroy"},
+			},
+			"content_sha256": {
+				Type:     schema.TypeString,
+				Computed: true,
 				ForceNew: true,
+				// Changes when the file behind file_path changes, causing a new upload
 			},
 		},
 	}
@@ -58,6 +134,10 @@ func resourceContentCreate(d *schema.ResourceData, m interface{}) error {
 	filePathRaw := nilIfEmptyString(d.Get("file_path"))
 	fileTypeRaw := nilIfEmptyString(d.Get("file_type"))
 	fileNameRaw := nilIfEmptyString(d.Get("file_name"))
+	contentRaw := nilIfEmptyString(d.Get("content"))
+	contentBase64Raw := nilIfEmptyString(d.Get("content_base64"))
+	sourceUrlRaw := nilIfEmptyString(d.Get("source_url"))
+	sourceSha256Raw := nilIfEmptyString(d.Get("source_sha256"))
 
 	if (originRaw != nil && mediaIdRaw == nil) || (originRaw == nil && mediaIdRaw != nil) {
 		return fmt.Errorf("both the media_id and origin must be supplied")
@@ -71,8 +151,14 @@ func resourceContentCreate(d *schema.ResourceData, m interface{}) error {
 	if mxcRaw != nil && (filePathRaw != nil || fileTypeRaw != nil || fileNameRaw != nil) {
 		return fmt.Errorf("origin and media_id cannot be provided alongside file information")
 	}
-	if mxcRaw == nil && filePathRaw == nil {
-		return fmt.Errorf("file_path must be supplied or an origin with media_id")
+	if mxcRaw != nil && (contentRaw != nil || contentBase64Raw != nil || sourceUrlRaw != nil) {
+		return fmt.Errorf("origin and media_id cannot be provided alongside content")
+	}
+	if mxcRaw == nil && filePathRaw == nil && contentRaw == nil && contentBase64Raw == nil && sourceUrlRaw == nil {
+		return fmt.Errorf("file_path, content, content_base64, or source_url must be supplied or an origin with media_id")
+	}
+	if sourceSha256Raw != nil && sourceUrlRaw == nil {
+		return fmt.Errorf("source_sha256 can only be used with a source_url")
 	}
 
 	if mxcRaw != nil {
@@ -99,16 +185,63 @@ func resourceContentCreate(d *schema.ResourceData, m interface{}) error {
 		}
 
 		log.Println("[DEBUG] Uploading media to create media object")
+		uploadLimit := getUploadLimit(meta, meta.DefaultAccessToken)
 
-		f, err := os.Open(filePathRaw.(string))
-		if err != nil {
-			return fmt.Errorf("error opening file: %s", err)
-		}
-		defer f.Close()
+		var content io.Reader
+		var contentLength int64
+		if contentRaw != nil {
+			content = strings.NewReader(contentRaw.(string))
+			contentLength = int64(len(contentRaw.(string)))
+		} else if contentBase64Raw != nil {
+			contentBytes, err := base64.StdEncoding.DecodeString(contentBase64Raw.(string))
+			if err != nil {
+				return fmt.Errorf("error decoding content_base64: %s", err)
+			}
+			content = bytes.NewReader(contentBytes)
+			contentLength = int64(len(contentBytes))
+		} else if sourceUrlRaw != nil {
+			stream, header, err := api.DownloadUrl(sourceUrlRaw.(string))
+			if stream != nil {
+				defer (*stream).Close()
+			}
+			if err != nil {
+				return fmt.Errorf("error downloading source_url: %s", err)
+			}
 
-		contentBytes, err := ioutil.ReadAll(f)
-		if err != nil {
-			return fmt.Errorf("error reading file: %s", err)
+			content = *stream
+			if sourceSha256Raw != nil {
+				content = newChecksumReader(content, sourceSha256Raw.(string))
+			}
+
+			if header.Get("Content-Length") != "" {
+				_, contentLength, _ = parseMediaHeaders(header)
+			} else {
+				// Uploads need a length, so sources which don't advertise one are downloaded before being uploaded
+				f, size, err := spoolMedia(content, uploadLimit)
+				if f != nil {
+					defer os.Remove(f.Name())
+					defer f.Close()
+				}
+				if err != nil {
+					return fmt.Errorf("error downloading source_url: %s", err)
+				}
+				content = f
+				contentLength = size
+			}
+		} else {
+			f, err := os.Open(filePathRaw.(string))
+			if err != nil {
+				return fmt.Errorf("error opening file: %s", err)
+			}
+			defer f.Close()
+
+			stat, err := f.Stat()
+			if err != nil {
+				return fmt.Errorf("error reading file: %s", err)
+			}
+
+			content = f
+			contentLength = stat.Size()
 		}
 
 		fileName := ""
@@ -116,15 +249,30 @@ func resourceContentCreate(d *schema.ResourceData, m interface{}) error {
 			fileName = fileNameRaw.(string)
 		}
 
-		contentType := "application/octet-stream"
+		// The file name is a better hint than the path, as it is what clients will see
+		typeHint := fileName
+		if typeHint == "" && filePathRaw != nil {
+			typeHint = filePathRaw.(string)
+		}
+		if typeHint == "" && sourceUrlRaw != nil {
+			if sourceUrl, err := url.Parse(sourceUrlRaw.(string)); err == nil {
+				typeHint = sourceUrl.Path
+			}
+		}
+		bufferedContent := bufio.NewReader(content)
+		detectedType := detectContentType(typeHint, bufferedContent)
+		d.Set("detected_file_type", detectedType)
+
+		contentType := detectedType
 		if fileTypeRaw != nil {
 			contentType = fileTypeRaw.(string)
 		}
 
-		result, err := api.UploadFile(meta.ClientApiUrl, contentBytes, fileName, contentType, meta.DefaultAccessToken)
+		result, hash, err := uploadMedia(meta, bufferedContent, contentLength, uploadLimit, fileName, contentType, meta.DefaultAccessToken)
 		if err != nil {
 			return fmt.Errorf("error uploading content: %s", err)
 		}
+		d.Set("content_sha256", hash)
 
 		mxc, origin, mediaId, err := stripMxc(result.ContentMxc)
 		if err != nil {
@@ -140,6 +288,50 @@ func resourceContentCreate(d *schema.ResourceData, m interface{}) error {
 	return resourceContentRead(d, meta)
 }
 
+func resourceContentCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	filePath := d.Get("file_path").(string)
+	if !d.NewValueKnown("file_path") || filePath == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		// The uploaded media is unaffected by the file going away, so keep it rather than failing the plan
+		log.Println("[WARN] File no longer exists, keeping the uploaded content:", filePath)
+		return nil
+	}
+
+	hash, err := hashFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	if hash != d.Get("content_sha256").(string) {
+		log.Println("[DEBUG] File contents changed, planning upload:", filePath)
+		err = d.SetNew("content_sha256", hash)
+		if err != nil {
+			return err
+		}
+		if d.Id() != "" {
+			return d.ForceNew("content_sha256")
+		}
+	}
+
+	return nil
+}
+
+func resourceContentImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	mxc, origin, mediaId, err := stripMxc(d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	d.SetId(mxc)
+	d.Set("origin", origin)
+	d.Set("media_id", mediaId)
+
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceContentExists(d *schema.ResourceData, m interface{}) (bool, error) {
 	meta := m.(Metadata)
 
@@ -147,30 +339,111 @@ func resourceContentExists(d *schema.ResourceData, m interface{}) (bool, error)
 	mediaId := d.Get("media_id").(string)
 
 	log.Println("[DEBUG] Checking to see if media exists")
-	stream, _, err := api.DownloadFile(meta.ClientApiUrl, origin, mediaId)
-	if stream != nil {
-		defer (*stream).Close()
-		io.Copy(ioutil.Discard, *stream)
-	}
+	_, err := api.HeadFile(meta.ClientApiUrl, origin, mediaId)
 	if err != nil {
-		log.Println("[DEBUG] Error downloading meda, assuming deleted:", err)
-		return false, nil
+		if r, ok := err.(*api.ErrorResponse); ok && (r.StatusCode == http.StatusNotFound || r.ErrorCode == api.ErrCodeNotFound) {
+			log.Println("[DEBUG] Media not found, assuming deleted:", err)
+			return false, nil
+		}
+		// We say true so that Terraform won't accidentally replace the media
+		return true, fmt.Errorf("error checking media: %s", err)
 	}
 
 	return true, nil
 }
 
 func resourceContentRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	origin := d.Get("origin").(string)
+	mediaId := d.Get("media_id").(string)
+
 	filePathRaw := nilIfEmptyString(d.Get("file_path"))
-	if filePathRaw == nil {
+	contentRaw := nilIfEmptyString(d.Get("content"))
+	contentBase64Raw := nilIfEmptyString(d.Get("content_base64"))
+	sourceUrlRaw := nilIfEmptyString(d.Get("source_url"))
+	if filePathRaw == nil && contentRaw == nil && contentBase64Raw == nil && sourceUrlRaw == nil {
 		d.Set("file_path", "")
 		d.Set("file_type", "")
 		d.Set("file_name", "")
 	}
+
+	log.Println("[DEBUG] Getting media metadata")
+	header, err := api.HeadFile(meta.ClientApiUrl, origin, mediaId)
+	if err != nil {
+		if r, ok := err.(*api.ErrorResponse); ok && (r.StatusCode == http.StatusNotFound || r.ErrorCode == api.ErrCodeNotFound) {
+			log.Println("[DEBUG] Media not found, considering it deleted:", err)
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("error getting media metadata: %s", err)
+	}
+
+	contentType, contentLength, fileName := parseMediaHeaders(header)
+	d.Set("content_type", contentType)
+	d.Set("content_length", contentLength)
+	d.Set("http_url", api.MakeDownloadUrl(meta.ClientApiUrl, origin, mediaId))
+
+	// A configured file_name is kept as-is so servers which don't echo it back don't cause a new upload
+	if fileName != "" && d.Get("file_name").(string) == "" {
+		d.Set("file_name", fileName)
+	}
+
 	return nil
 }
 
+func resourceContentUpdate(d *schema.ResourceData, m interface{}) error {
+	// Everything other than the destroy options is ForceNew, and those are only used when deleting
+	return resourceContentRead(d, m)
+}
+
 func resourceContentDelete(d *schema.ResourceData, m interface{}) error {
-	// Content cannot be deleted in matrix (yet), so we just fake it
+	meta := m.(Metadata)
+
+	origin := d.Get("origin").(string)
+	mediaId := d.Get("media_id").(string)
+
+	if d.Get("delete_on_destroy").(bool) {
+		if meta.AdminAccessToken == "" {
+			return fmt.Errorf("an admin access token is required to delete media")
+		}
+
+		response := &api.AdminDeleteMediaResponse{}
+		urlStr := api.MakeUrl(meta.ClientApiUrl, "/_synapse/admin/v1/media/", origin, mediaId)
+		log.Println("[DEBUG] Deleting media:", urlStr)
+		err := api.DoRequest("DELETE", urlStr, nil, response, meta.AdminAccessToken)
+		if err != nil {
+			if r, ok := err.(*api.ErrorResponse); ok && r.StatusCode == http.StatusNotFound {
+				log.Println("[DEBUG] Media already deleted")
+				return nil
+			}
+			return fmt.Errorf("error deleting media (remote media can only be quarantined): %s", err)
+		}
+		return nil
+	}
+
+	if d.Get("quarantine_on_destroy").(bool) {
+		if meta.AdminAccessToken == "" {
+			return fmt.Errorf("an admin access token is required to quarantine media")
+		}
+
+		urlStr := api.MakeUrl(meta.ClientApiUrl, "/_synapse/admin/v1/media/quarantine/", origin, mediaId)
+		log.Println("[DEBUG] Quarantining media:", urlStr)
+		err := api.DoRequest("POST", urlStr, nil, nil, meta.AdminAccessToken)
+		if err != nil {
+			return fmt.Errorf("error quarantining media: %s", err)
+		}
+		return nil
+	}
+
+	// Content cannot be deleted in matrix without admin APIs, so we just fake it
 	return nil
 }
+
+func validateBase64(v interface{}, k string) ([]string, []error) {
+	_, err := base64.StdEncoding.DecodeString(v.(string))
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s is not valid base64: %s", k, err)}
+	}
+	return nil, nil
+}
@@ -7,11 +7,18 @@ import (
 	"github.com/turt2live/terraform-provider-matrix/matrix/api"
 	"github.com/hashicorp/terraform/terraform"
 	"regexp"
+	"bytes"
+	"github.com/hashicorp/terraform/config"
+	"path/filepath"
+	"github.com/hashicorp/terraform/helper/schema"
+	"net/http"
+	"net/http/httptest"
 	"io"
 	"io/ioutil"
 	"mime"
 	"os"
 	"path"
+	"strings"
 )
 
 type testAccMatrixContentUpload struct {
@@ -25,7 +32,7 @@ type testAccMatrixContentUpload struct {
 }
 
 func testAccCreateMatrixContent(content []byte, mime string, fileName string) (*testAccMatrixContentUpload) {
-	response, err := api.UploadFile(testAccClientServerUrl(), content, fileName, mime, testAccAdminToken())
+	response, err := api.UploadFile(testAccClientServerUrl(), bytes.NewReader(content), int64(len(content)), 0, fileName, mime, testAccAdminToken())
 	if err != nil {
 		panic(err)
 	}
@@ -111,6 +118,7 @@ func TestAccMatrixContent_PlainTextUpload(t *testing.T) {
 					resource.TestCheckResourceAttr("matrix_content.foobar", "file_path", upload.FilePath),
 					resource.TestCheckResourceAttr("matrix_content.foobar", "file_name", upload.FileName),
 					resource.TestCheckResourceAttr("matrix_content.foobar", "file_type", upload.FileType),
+					resource.TestCheckResourceAttr("matrix_content.foobar", "content_sha256", "35c6b9f66dceb6cf8f733d08689564e420e18eb40250d9435352617c027f36d6"),
 				),
 			},
 		},
@@ -273,6 +281,29 @@ func TestAccMatrixContent_UploadNoNameOrType(t *testing.T) {
 	})
 }
 
+func TestAccMatrixContent_Import(t *testing.T) {
+	upload := testAccCreateMatrixContent([]byte("hello world"), "text/plain", "hello.txt")
+	conf := fmt.Sprintf(testAccMatrixContentConfig_existingContent, upload.Origin, upload.MediaId)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		// We don't check if content get destroyed because it isn't
+		//CheckDestroy: testAccCheckMatrixContentDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+			},
+			{
+				ResourceName:      "matrix_content.foobar",
+				ImportState:       true,
+				ImportStateId:     upload.Mxc,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
 func testAccCheckMatrixContentExists(n string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		meta := testAccProvider.Meta().(Metadata)
@@ -434,3 +465,693 @@ func testAccCheckMatrixContentIdMatchesProperties(n string) resource.TestCheckFu
 		return nil
 	}
 }
+
+var testAccMatrixContentConfig_inline = `
+resource "matrix_content" "foobar" {
+	content = "%s"
+	file_name = "%s"
+	file_type = "%s"
+}`
+
+func TestAccMatrixContent_InlineUpload(t *testing.T) {
+	upload := &testAccMatrixContentUpload{
+		Content:  []byte(`{"hello":"world"}`),
+		FileName: "config.json",
+		FileType: "application/json",
+	}
+	conf := fmt.Sprintf(testAccMatrixContentConfig_inline, `{\"hello\":\"world\"}`, upload.FileName, upload.FileType)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		// We don't check if content get destroyed because it isn't
+		//CheckDestroy: testAccCheckMatrixContentDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixContentExists("matrix_content.foobar"),
+					testAccCheckMatrixContentMatchesFile("matrix_content.foobar", upload),
+					testAccCheckMatrixContentIdMatchesProperties("matrix_content.foobar"),
+					resource.TestCheckResourceAttr("matrix_content.foobar", "file_name", upload.FileName),
+					resource.TestCheckResourceAttr("matrix_content.foobar", "file_type", upload.FileType),
+				),
+			},
+		},
+	})
+}
+
+var testAccMatrixContentConfig_inlineWithMxc = `
+resource "matrix_content" "foobar" {
+	origin = "localhost"
+	media_id = "SomeMedia"
+	content_base64 = "aGVsbG8gd29ybGQ="
+}`
+
+func TestAccMatrixContent_InlineWithMxcFails(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      testAccMatrixContentConfig_inlineWithMxc,
+				ExpectError: regexp.MustCompile("origin and media_id cannot be provided alongside content"),
+			},
+		},
+	})
+}
+
+var testAccMatrixContentConfig_deleteOnDestroy = `
+resource "matrix_content" "foobar" {
+	content = "%s"
+	delete_on_destroy = true
+}`
+
+func TestAccMatrixContent_DeleteOnDestroy(t *testing.T) {
+	conf := fmt.Sprintf(testAccMatrixContentConfig_deleteOnDestroy, "delete me")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixContentDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixContentExists("matrix_content.foobar"),
+					resource.TestCheckResourceAttr("matrix_content.foobar", "delete_on_destroy", "true"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckMatrixContentDestroy(s *terraform.State) error {
+	meta := testAccProvider.Meta().(Metadata)
+
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "matrix_content" {
+			continue
+		}
+
+		_, err := api.HeadFile(meta.ClientApiUrl, rs.Primary.Attributes["origin"], rs.Primary.Attributes["media_id"])
+		if err == nil {
+			return fmt.Errorf("media still exists: %s", rs.Primary.ID)
+		}
+		if r, ok := err.(*api.ErrorResponse); !ok || r.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("error checking media: %s", err)
+		}
+	}
+
+	return nil
+}
+
+var testAccMatrixContentConfig_sourceUrl = `
+resource "matrix_content" "foobar" {
+	source_url = "%s"
+	source_sha256 = "%s"
+}`
+
+func TestAccMatrixContent_SourceUrl(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer source.Close()
+
+	upload := &testAccMatrixContentUpload{
+		Content:  []byte("hello world"),
+		FileType: "text/plain; charset=utf-8", // expected type, from the extension
+	}
+	conf := fmt.Sprintf(testAccMatrixContentConfig_sourceUrl, source.URL+"/assets/words.txt", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		// We don't check if content get destroyed because it isn't
+		//CheckDestroy: testAccCheckMatrixContentDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixContentExists("matrix_content.foobar"),
+					testAccCheckMatrixContentMatchesFile("matrix_content.foobar", upload),
+					testAccCheckMatrixContentIdMatchesProperties("matrix_content.foobar"),
+					resource.TestCheckResourceAttr("matrix_content.foobar", "content_sha256", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"),
+					resource.TestCheckResourceAttr("matrix_content.foobar", "detected_file_type", upload.FileType),
+				),
+			},
+		},
+	})
+}
+
+func TestUnitContentCreate_inlineBase64(t *testing.T) {
+	var uploaded []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/_matrix/media/r0/config":
+			w.Write([]byte(`{}`))
+		case r.Method == "POST" && r.URL.Path == "/_matrix/media/r0/upload":
+			uploaded, _ = ioutil.ReadAll(r.Body)
+			w.Write([]byte(`{"content_uri":"mxc://localhost/Uploaded"}`))
+		case r.Method == "HEAD" && r.URL.Path == "/_matrix/media/r0/download/localhost/Uploaded":
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceContent().Schema, map[string]interface{}{
+		"content_base64": "aGVsbG8gd29ybGQ=",
+		"file_type":      "text/plain",
+	})
+
+	err := resourceContentCreate(d, Metadata{ClientApiUrl: server.URL, DefaultAccessToken: "default_token"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(uploaded) != "hello world" {
+		t.Errorf("unexpected upload: %s", string(uploaded))
+	}
+	if d.Id() != "mxc://localhost/Uploaded" {
+		t.Errorf("unexpected id: %s", d.Id())
+	}
+	if d.Get("content_sha256").(string) != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected content_sha256: %s", d.Get("content_sha256"))
+	}
+	if d.Get("file_type").(string) != "text/plain" {
+		t.Errorf("file_type was not kept: %s", d.Get("file_type"))
+	}
+}
+
+func TestUnitContentCreate_detectsFileType(t *testing.T) {
+	var uploadedType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/_matrix/media/r0/config":
+			w.Write([]byte(`{}`))
+		case r.Method == "POST" && r.URL.Path == "/_matrix/media/r0/upload":
+			uploadedType = r.Header.Get("Content-Type")
+			w.Write([]byte(`{"content_uri":"mxc://localhost/Uploaded"}`))
+		case r.Method == "HEAD" && r.URL.Path == "/_matrix/media/r0/download/localhost/Uploaded":
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// A PNG header, without a file name to hint at the type
+	d := schema.TestResourceDataRaw(t, resourceContent().Schema, map[string]interface{}{
+		"content_base64": "iVBORw0KGgoAAAANSUhEUg==",
+	})
+
+	err := resourceContentCreate(d, Metadata{ClientApiUrl: server.URL, DefaultAccessToken: "default_token"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if uploadedType != "image/png" {
+		t.Errorf("unexpected uploaded content type: %s", uploadedType)
+	}
+	if d.Get("detected_file_type").(string) != "image/png" {
+		t.Errorf("unexpected detected_file_type: %s", d.Get("detected_file_type"))
+	}
+}
+
+func TestUnitContentValidateBase64(t *testing.T) {
+	if _, errs := validateBase64("aGVsbG8gd29ybGQ=", "content_base64"); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if _, errs := validateBase64("not base64!", "content_base64"); len(errs) == 0 {
+		t.Errorf("expected an error for invalid base64")
+	}
+}
+
+func testUnitContentDiff(t *testing.T, filePath string, contentSha256 string) *terraform.InstanceDiff {
+	state := &terraform.InstanceState{
+		ID: "mxc://localhost/SomeMedia",
+		Attributes: map[string]string{
+			"origin":         "localhost",
+			"media_id":       "SomeMedia",
+			"file_path":      filePath,
+			"content_sha256": contentSha256,
+		},
+	}
+	rawConfig, err := config.NewRawConfig(map[string]interface{}{"file_path": filePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := resourceContent().Diff(state, terraform.NewResourceConfig(rawConfig), Metadata{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return diff
+}
+
+func TestUnitContentDiff_changedFileForcesNew(t *testing.T) {
+	filePath := testUnitWriteTempFile(t, "words.txt", "hello world")
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	diff := testUnitContentDiff(t, filePath, "0000000000000000000000000000000000000000000000000000000000000000")
+	if diff == nil || !diff.RequiresNew() {
+		t.Fatalf("expected the diff to require a new resource, got: %#v", diff)
+	}
+	if diff.Attributes["content_sha256"].New != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected content_sha256 diff: %#v", diff.Attributes["content_sha256"])
+	}
+}
+
+func TestUnitContentDiff_unchangedFile(t *testing.T) {
+	filePath := testUnitWriteTempFile(t, "words.txt", "hello world")
+	defer os.RemoveAll(filepath.Dir(filePath))
+
+	diff := testUnitContentDiff(t, filePath, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9")
+	if diff != nil && !diff.Empty() {
+		t.Errorf("expected no diff, got: %#v", diff)
+	}
+}
+
+func TestUnitContentDiff_missingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform-provider-matrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	diff := testUnitContentDiff(t, filepath.Join(dir, "deleted.txt"), "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9")
+	if diff != nil && !diff.Empty() {
+		t.Errorf("expected no diff, got: %#v", diff)
+	}
+}
+
+func TestUnitContentExists(t *testing.T) {
+	cases := []struct {
+		name       string
+		headStatus int
+		getStatus  int
+		getBody    string
+		exists     bool
+		expectErr  bool
+	}{
+		{"head ok", http.StatusOK, 0, "", true, false},
+		{"head not found", http.StatusNotFound, 0, "", false, false},
+		{"head transient error", http.StatusBadGateway, 0, "", true, true},
+		{"ranged get ok", http.StatusMethodNotAllowed, http.StatusPartialContent, "a", true, false},
+		{"ranged get not found", http.StatusMethodNotAllowed, http.StatusNotFound, `{"errcode":"M_NOT_FOUND","error":"Not found"}`, false, false},
+		{"ranged get transient error", http.StatusMethodNotAllowed, http.StatusInternalServerError, `{"errcode":"M_UNKNOWN","error":"Oops"}`, true, true},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/_matrix/media/r0/download/localhost/SomeMedia" {
+				t.Errorf("%s: unexpected request: %s %s", c.name, r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			if r.Method == "HEAD" {
+				w.WriteHeader(c.headStatus)
+				return
+			}
+			if c.getStatus == 0 {
+				t.Errorf("%s: unexpected GET request", c.name)
+			}
+			if r.Header.Get("Range") != "bytes=0-0" {
+				t.Errorf("%s: expected a ranged request, got range: %s", c.name, r.Header.Get("Range"))
+			}
+			w.WriteHeader(c.getStatus)
+			w.Write([]byte(c.getBody))
+		}))
+
+		d := schema.TestResourceDataRaw(t, resourceContent().Schema, map[string]interface{}{
+			"origin":   "localhost",
+			"media_id": "SomeMedia",
+		})
+		d.SetId("mxc://localhost/SomeMedia")
+
+		exists, err := resourceContentExists(d, Metadata{ClientApiUrl: server.URL})
+		if exists != c.exists {
+			t.Errorf("%s: unexpected existence. expected: %t  got: %t", c.name, c.exists, exists)
+		}
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+
+		server.Close()
+	}
+}
+
+func TestUnitContentRead_mediaMetadata(t *testing.T) {
+	cases := []struct {
+		name         string
+		headStatus   int
+		headers      map[string]string
+		fileName     string
+		wantLength   int
+		wantFileName string
+	}{
+		{"head", http.StatusOK, map[string]string{"Content-Length": "11", "Content-Disposition": `inline; filename="words.txt"`}, "", 11, "words.txt"},
+		{"encoded file name", http.StatusOK, map[string]string{"Content-Length": "11", "Content-Disposition": "inline; filename*=utf-8''w%C3%B6rds.txt"}, "", 11, "wörds.txt"},
+		{"configured file name", http.StatusOK, map[string]string{"Content-Length": "11", "Content-Disposition": `inline; filename="other.txt"`}, "words.txt", 11, "words.txt"},
+		{"ranged get", http.StatusMethodNotAllowed, map[string]string{"Content-Range": "bytes 0-0/11", "Content-Disposition": `inline; filename="words.txt"`}, "", 11, "words.txt"},
+		{"no disposition", http.StatusOK, map[string]string{"Content-Length": "11"}, "", 11, ""},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/_matrix/media/r0/download/localhost/SomeMedia" {
+				t.Errorf("%s: unexpected request: %s %s", c.name, r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			w.Header().Set("Content-Type", "text/plain")
+			if r.Method == "HEAD" && c.headStatus != http.StatusOK {
+				w.WriteHeader(c.headStatus)
+				return
+			}
+			for k, v := range c.headers {
+				w.Header().Set(k, v)
+			}
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("h"))
+		}))
+
+		raw := map[string]interface{}{
+			"content":  "hello world",
+			"origin":   "localhost",
+			"media_id": "SomeMedia",
+		}
+		if c.fileName != "" {
+			raw["file_name"] = c.fileName
+		}
+		d := schema.TestResourceDataRaw(t, resourceContent().Schema, raw)
+		d.SetId("mxc://localhost/SomeMedia")
+
+		err := resourceContentRead(d, Metadata{ClientApiUrl: server.URL})
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", c.name, err)
+		}
+		if d.Get("content_type").(string) != "text/plain" {
+			t.Errorf("%s: unexpected content_type: %s", c.name, d.Get("content_type"))
+		}
+		if d.Get("content_length").(int) != c.wantLength {
+			t.Errorf("%s: unexpected content_length: %d", c.name, d.Get("content_length"))
+		}
+		if d.Get("file_name").(string) != c.wantFileName {
+			t.Errorf("%s: unexpected file_name: %s", c.name, d.Get("file_name"))
+		}
+		if d.Get("http_url").(string) != server.URL+"/_matrix/media/r0/download/localhost/SomeMedia" {
+			t.Errorf("%s: unexpected http_url: %s", c.name, d.Get("http_url"))
+		}
+
+		server.Close()
+	}
+}
+
+func TestUnitContentRead_notFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceContent().Schema, map[string]interface{}{
+		"origin":   "localhost",
+		"media_id": "SomeMedia",
+	})
+	d.SetId("mxc://localhost/SomeMedia")
+
+	err := resourceContentRead(d, Metadata{ClientApiUrl: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if d.Id() != "" {
+		t.Errorf("expected the media to be removed from state, got id: %s", d.Id())
+	}
+}
+
+func TestUnitContentDelete_adminApis(t *testing.T) {
+	cases := []struct {
+		name       string
+		option     string
+		adminToken string
+		status     int
+		wantMethod string
+		wantPath   string
+		expectErr  bool
+	}{
+		{"not deleted", "", "admin_token", 0, "", "", false},
+		{"delete", "delete_on_destroy", "admin_token", http.StatusOK, "DELETE", "/_synapse/admin/v1/media/localhost/SomeMedia", false},
+		{"delete already gone", "delete_on_destroy", "admin_token", http.StatusNotFound, "DELETE", "/_synapse/admin/v1/media/localhost/SomeMedia", false},
+		{"delete remote", "delete_on_destroy", "admin_token", http.StatusBadRequest, "DELETE", "/_synapse/admin/v1/media/localhost/SomeMedia", true},
+		{"delete without admin", "delete_on_destroy", "", 0, "", "", true},
+		{"quarantine", "quarantine_on_destroy", "admin_token", http.StatusOK, "POST", "/_synapse/admin/v1/media/quarantine/localhost/SomeMedia", false},
+		{"quarantine without admin", "quarantine_on_destroy", "", 0, "", "", true},
+	}
+
+	for _, c := range cases {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if r.Method != c.wantMethod || r.URL.Path != c.wantPath {
+				t.Errorf("%s: unexpected request: %s %s", c.name, r.Method, r.URL.Path)
+			}
+			if r.Header.Get("Authorization") != "Bearer admin_token" {
+				t.Errorf("%s: unexpected authorization: %s", c.name, r.Header.Get("Authorization"))
+			}
+			w.WriteHeader(c.status)
+			if c.status == http.StatusOK {
+				w.Write([]byte(`{"deleted_media":["SomeMedia"],"total":1}`))
+			} else {
+				w.Write([]byte(`{"errcode":"M_UNKNOWN","error":"Nope"}`))
+			}
+		}))
+
+		raw := map[string]interface{}{
+			"origin":   "localhost",
+			"media_id": "SomeMedia",
+		}
+		if c.option != "" {
+			raw[c.option] = true
+		}
+		d := schema.TestResourceDataRaw(t, resourceContent().Schema, raw)
+		d.SetId("mxc://localhost/SomeMedia")
+
+		err := resourceContentDelete(d, Metadata{ClientApiUrl: server.URL, AdminAccessToken: c.adminToken})
+		if (err != nil) != c.expectErr {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+		}
+		if c.wantPath != "" && requests != 1 {
+			t.Errorf("%s: expected one request, got %d", c.name, requests)
+		}
+		if c.wantPath == "" && requests != 0 {
+			t.Errorf("%s: expected no requests, got %d", c.name, requests)
+		}
+
+		server.Close()
+	}
+}
+
+func TestUnitContentCreate_sourceUrl(t *testing.T) {
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/assets/words.txt" {
+			t.Errorf("unexpected source request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("hello world"))
+	}))
+	defer source.Close()
+
+	var uploaded []byte
+	var uploadedType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/_matrix/media/r0/config":
+			w.Write([]byte(`{}`))
+		case r.Method == "POST" && r.URL.Path == "/_matrix/media/r0/upload":
+			uploaded, _ = ioutil.ReadAll(r.Body)
+			uploadedType = r.Header.Get("Content-Type")
+			w.Write([]byte(`{"content_uri":"mxc://localhost/Uploaded"}`))
+		case r.Method == "HEAD" && r.URL.Path == "/_matrix/media/r0/download/localhost/Uploaded":
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceContent().Schema, map[string]interface{}{
+		"source_url":    source.URL + "/assets/words.txt",
+		"source_sha256": "B94D27B9934D3E08A52E52D7DA7DABFAC484EFE37A5380EE9088F7ACE2EFCDE9",
+	})
+
+	err := resourceContentCreate(d, Metadata{ClientApiUrl: server.URL, DefaultAccessToken: "default_token"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if string(uploaded) != "hello world" {
+		t.Errorf("unexpected upload: %s", string(uploaded))
+	}
+	if uploadedType != "text/plain; charset=utf-8" {
+		t.Errorf("unexpected uploaded content type: %s", uploadedType)
+	}
+	if d.Id() != "mxc://localhost/Uploaded" {
+		t.Errorf("unexpected id: %s", d.Id())
+	}
+	if d.Get("content_sha256").(string) != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected content_sha256: %s", d.Get("content_sha256"))
+	}
+}
+
+func TestUnitContentCreate_sourceUrlChecksumMismatch(t *testing.T) {
+	cases := []struct {
+		name    string
+		chunked bool
+	}{
+		{"advertised length", false},
+		{"chunked", true},
+	}
+
+	for _, c := range cases {
+		source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c.chunked {
+				// Flushing before writing sends the body chunked, without a Content-Length
+				w.WriteHeader(http.StatusOK)
+				w.(http.Flusher).Flush()
+			}
+			w.Write([]byte("hello world"))
+		}))
+
+		// Chunked sources are checked while they are downloaded, before anything is uploaded
+		completed := false
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/_matrix/media/r0/config":
+				w.Write([]byte(`{}`))
+			case r.Method == "POST" && r.URL.Path == "/_matrix/media/r0/upload":
+				_, err := ioutil.ReadAll(r.Body)
+				if err == nil {
+					completed = true
+				}
+				w.Write([]byte(`{"content_uri":"mxc://localhost/Uploaded"}`))
+			default:
+				t.Errorf("%s: unexpected request: %s %s", c.name, r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		d := schema.TestResourceDataRaw(t, resourceContent().Schema, map[string]interface{}{
+			"source_url":    source.URL + "/words.txt",
+			"source_sha256": "0000000000000000000000000000000000000000000000000000000000000000",
+		})
+
+		err := resourceContentCreate(d, Metadata{ClientApiUrl: server.URL, DefaultAccessToken: "default_token"})
+		if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Errorf("%s: expected a checksum error, got: %v", c.name, err)
+		}
+		if d.Id() != "" {
+			t.Errorf("%s: expected no id, got: %s", c.name, d.Id())
+		}
+
+		// Closing waits for the upload handler to finish
+		server.Close()
+		source.Close()
+		if completed {
+			t.Errorf("%s: expected the upload to be aborted", c.name)
+		}
+	}
+}
+
+func TestUnitContentCreate_sourceUrlUnknownLength(t *testing.T) {
+	cases := []struct {
+		name       string
+		uploadSize int
+		expectErr  bool
+	}{
+		{"within upload limit", 1024, false},
+		{"no upload limit", 0, false},
+		{"over upload limit", 5, true},
+	}
+
+	for _, c := range cases {
+		source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Flushing before writing sends the body chunked, without a Content-Length
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			w.Write([]byte("hello world"))
+		}))
+
+		uploads := 0
+		configRequests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/_matrix/media/r0/config":
+				configRequests++
+				if c.uploadSize > 0 {
+					w.Write([]byte(fmt.Sprintf(`{"m.upload.size":%d}`, c.uploadSize)))
+				} else {
+					w.Write([]byte(`{}`))
+				}
+			case r.Method == "POST" && r.URL.Path == "/_matrix/media/r0/upload":
+				uploads++
+				// Synapse rejects uploads without a Content-Length
+				if r.ContentLength != 11 || len(r.TransferEncoding) != 0 {
+					t.Errorf("%s: expected an upload with a Content-Length of 11, got: %d %v", c.name, r.ContentLength, r.TransferEncoding)
+				}
+				uploaded, _ := ioutil.ReadAll(r.Body)
+				if string(uploaded) != "hello world" {
+					t.Errorf("%s: unexpected upload: %s", c.name, string(uploaded))
+				}
+				w.Write([]byte(`{"content_uri":"mxc://localhost/Uploaded"}`))
+			case r.Method == "HEAD" && r.URL.Path == "/_matrix/media/r0/download/localhost/Uploaded":
+				w.WriteHeader(http.StatusOK)
+			default:
+				t.Errorf("%s: unexpected request: %s %s", c.name, r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		d := schema.TestResourceDataRaw(t, resourceContent().Schema, map[string]interface{}{
+			"source_url": source.URL + "/words.txt",
+		})
+
+		err := resourceContentCreate(d, Metadata{ClientApiUrl: server.URL, DefaultAccessToken: "default_token"})
+		if c.expectErr {
+			if err == nil || !strings.Contains(err.Error(), "upload limit") {
+				t.Errorf("%s: expected an upload limit error, got: %v", c.name, err)
+			}
+		} else {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %s", c.name, err)
+			}
+			if d.Get("content_sha256").(string) != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+				t.Errorf("%s: unexpected content_sha256: %s", c.name, d.Get("content_sha256"))
+			}
+		}
+
+		server.Close()
+		source.Close()
+		if c.expectErr && uploads != 0 {
+			t.Errorf("%s: expected nothing to be uploaded", c.name)
+		}
+		if !c.expectErr && uploads != 1 {
+			t.Errorf("%s: expected one upload, got %d", c.name, uploads)
+		}
+		// The limit is checked while downloading and again before uploading, but only needs to be fetched once
+		if configRequests != 1 {
+			t.Errorf("%s: expected the media config to be fetched once, got %d", c.name, configRequests)
+		}
+	}
+}
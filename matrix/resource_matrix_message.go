@@ -0,0 +1,297 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"net/http"
+	"net/url"
+	"encoding/json"
+	"strconv"
+)
+
+func resourceMessage() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceMessageCreate,
+		Read:   resourceMessageRead,
+		Update: resourceMessageUpdate,
+		Delete: resourceMessageDelete,
+
+		Schema: map[string]*schema.Schema{
+			"room_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"member_access_token": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"msgtype": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "m.text",
+				ValidateFunc: validation.StringInSlice([]string{"m.text", "m.notice", "m.emote"}, false),
+			},
+			"body": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.NoZeroValues,
+			},
+			"formatted_body": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// HTML (org.matrix.custom.html)
+			},
+			"event_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"txn_nonce": {
+				Type:     schema.TypeString,
+				Computed: true,
+				// Random rather than derived from the configuration, as nothing in it tells apart two resources posting
+				// the same message to the same room. The transaction IDs of the message, its edits, and its redaction
+				// are all derived from it, so retrying any of them is deduplicated by the server.
+			},
+			"edit_count": {
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceMessageCreate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	roomId := d.Get("room_id").(string)
+	content := resourceMessageContent(d)
+
+	nonce, err := makeNonce()
+	if err != nil {
+		return err
+	}
+
+	eventId, err := resourceMessageSend(d, meta, makeTxnId(nonce), content)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s", roomId, eventId))
+	d.Set("event_id", eventId)
+	d.Set("txn_nonce", nonce)
+	d.Set("edit_count", 0)
+	return resourceMessageRead(d, meta)
+}
+
+func resourceMessageRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	memberAccessToken := d.Get("member_access_token").(string)
+	roomId := d.Get("room_id").(string)
+	eventId := d.Get("event_id").(string)
+
+	event, err := getRoomEvent(meta, roomId, eventId, memberAccessToken)
+	if err != nil {
+		return err
+	}
+	if event == nil || isRedacted(event) {
+		log.Println("[DEBUG] Message not found or redacted, considering it deleted")
+		d.SetId("")
+		return nil
+	}
+
+	content := &api.RoomMessageEventContent{}
+	err = json.Unmarshal(event.Content, content)
+	if err != nil {
+		return fmt.Errorf("error parsing message: %s", err)
+	}
+
+	// The original event never changes when it is edited, so the current content comes from the latest edit
+	edit, err := getLatestMessageEdit(meta, roomId, event, memberAccessToken)
+	if err != nil {
+		return err
+	}
+	if edit != nil {
+		content = edit
+	}
+
+	d.Set("msgtype", content.MsgType)
+	d.Set("body", content.Body)
+	if content.Format == api.FormatHtml {
+		d.Set("formatted_body", content.FormattedBody)
+	} else {
+		d.Set("formatted_body", "")
+	}
+
+	return nil
+}
+
+func resourceMessageUpdate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	if d.HasChange("msgtype") || d.HasChange("body") || d.HasChange("formatted_body") {
+		eventId := d.Get("event_id").(string)
+		newContent := resourceMessageContent(d)
+
+		// Edits are sent as replacements so the original event (and our ID) stays the same
+		content := &api.RoomMessageEventContent{
+			MsgType:    newContent.MsgType,
+			Body:       "* " + newContent.Body,
+			NewContent: newContent,
+			RelatesTo: &api.RelatesTo{
+				RelationType: api.RelationTypeReplace,
+				EventId:      eventId,
+			},
+		}
+		if newContent.FormattedBody != "" {
+			content.Format = newContent.Format
+			content.FormattedBody = "* " + newContent.FormattedBody
+		}
+
+		// Messages created before the nonce was tracked get one now
+		nonce := d.Get("txn_nonce").(string)
+		if nonce == "" {
+			var err error
+			nonce, err = makeNonce()
+			if err != nil {
+				return err
+			}
+			d.Set("txn_nonce", nonce)
+		}
+
+		// Every edit gets its own transaction so that going back to earlier content isn't deduplicated
+		editCount := d.Get("edit_count").(int) + 1
+		_, err := resourceMessageSend(d, meta, makeTxnId(nonce, "edit", strconv.Itoa(editCount)), content)
+		if err != nil {
+			return err
+		}
+		d.Set("edit_count", editCount)
+	}
+
+	return resourceMessageRead(d, meta)
+}
+
+func resourceMessageDelete(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	memberAccessToken := d.Get("member_access_token").(string)
+	roomId := d.Get("room_id").(string)
+	eventId := d.Get("event_id").(string)
+
+	request := &api.RedactRequest{}
+	response := &api.EventIdResponse{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/redact/", url.PathEscape(eventId), makeTxnId(d.Get("txn_nonce").(string), "redact", eventId))
+	log.Println("[DEBUG] Redacting message:", urlStr)
+	err := api.DoRequest("PUT", urlStr, request, response, memberAccessToken)
+	if err != nil {
+		return fmt.Errorf("error redacting message: %s", err)
+	}
+
+	return nil
+}
+
+func resourceMessageContent(d *schema.ResourceData) *api.RoomMessageEventContent {
+	content := &api.RoomMessageEventContent{
+		MsgType: d.Get("msgtype").(string),
+		Body:    d.Get("body").(string),
+	}
+
+	formattedBody := d.Get("formatted_body").(string)
+	if formattedBody != "" {
+		content.Format = api.FormatHtml
+		content.FormattedBody = formattedBody
+	}
+
+	return content
+}
+
+func resourceMessageSend(d *schema.ResourceData, meta Metadata, txnId string, content *api.RoomMessageEventContent) (string, error) {
+	memberAccessToken := d.Get("member_access_token").(string)
+	roomId := d.Get("room_id").(string)
+
+	response := &api.EventIdResponse{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/send/m.room.message/", txnId)
+	log.Println("[DEBUG] Sending message:", urlStr)
+	err := api.DoRequest("PUT", urlStr, content, response, memberAccessToken)
+	if err != nil {
+		return "", fmt.Errorf("error sending message: %s", err)
+	}
+
+	return response.EventId, nil
+}
+
+func getRoomEvent(meta Metadata, roomId string, eventId string, accessToken string) (*api.RoomEvent, error) {
+	event := &api.RoomEvent{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/event/", url.PathEscape(eventId))
+	log.Println("[DEBUG] Getting event:", urlStr)
+	err := api.DoRequest("GET", urlStr, nil, event, accessToken)
+	if err != nil {
+		if r, ok := err.(*api.ErrorResponse); ok && r.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting event: %s", err)
+	}
+
+	return event, nil
+}
+
+func isRedacted(event *api.RoomEvent) bool {
+	return event.Unsigned != nil && len(event.Unsigned.RedactedBecause) > 0
+}
+
+// getLatestMessageEdit returns the new content of the most recent valid edit to the given message, or nil if it has
+// never been edited. Edits from anyone other than the original sender are ignored. Servers which don't support the
+// stable relations API are asked through the unstable one, and servers supporting neither are assumed to have no edits.
+func getLatestMessageEdit(meta Metadata, roomId string, event *api.RoomEvent, accessToken string) (*api.RoomMessageEventContent, error) {
+	for _, prefix := range []string{"/_matrix/client/v1", "/_matrix/client/unstable"} {
+		edit, err := getLatestMessageEditFrom(meta, prefix, roomId, event, accessToken)
+		if err == nil {
+			return edit, nil
+		}
+		if r, ok := err.(*api.ErrorResponse); !ok || (r.StatusCode != http.StatusNotFound && r.ErrorCode != api.ErrCodeUnrecognized) {
+			return nil, fmt.Errorf("error getting message edits: %s", err)
+		}
+		log.Println("[DEBUG] Relations API not supported under", prefix, ":", err)
+	}
+
+	log.Println("[DEBUG] Server doesn't support relations, assuming the message hasn't been edited")
+	return nil, nil
+}
+
+func getLatestMessageEditFrom(meta Metadata, prefix string, roomId string, event *api.RoomEvent, accessToken string) (*api.RoomMessageEventContent, error) {
+	qs := map[string]string{"dir": "b"}
+	for {
+		response := &api.RelationsResponse{}
+		urlStr := api.MakeUrlQueryString(qs, meta.ClientApiUrl, prefix, "/rooms/", roomId, "/relations/", url.PathEscape(event.EventId), api.RelationTypeReplace)
+		log.Println("[DEBUG] Getting message edits:", urlStr)
+		err := api.DoRequest("GET", urlStr, nil, response, accessToken)
+		if err != nil {
+			return nil, err
+		}
+
+		// Newest edits come first
+		for _, edit := range response.Chunk {
+			if edit.Type != "m.room.message" || edit.Sender != event.Sender || isRedacted(&edit) {
+				continue
+			}
+
+			content := &api.RoomMessageEventContent{}
+			err = json.Unmarshal(edit.Content, content)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing message edit: %s", err)
+			}
+			if content.NewContent != nil {
+				return content.NewContent, nil
+			}
+		}
+
+		if response.NextBatch == "" || len(response.Chunk) == 0 {
+			return nil, nil
+		}
+		qs["from"] = response.NextBatch
+	}
+}
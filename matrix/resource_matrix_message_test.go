@@ -0,0 +1,291 @@
+package matrix
+
+import (
+	"testing"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+	"fmt"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+	"strings"
+	"io/ioutil"
+)
+
+var testAccMatrixMessageConfig_basic = `
+resource "matrix_message" "foobar" {
+	room_id = "%s"
+	member_access_token = "%s"
+	msgtype = "m.notice"
+	body = "%s"
+	formatted_body = "<b>%s</b>"
+}`
+
+func TestAccMatrixMessage_SendEditRedact(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", false, "private_chat")
+	var originalEventId string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixMessageDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccMatrixMessageConfig_basic, room.RoomId, room.CreatorToken, "Welcome!", "Welcome!"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixMessageContent("matrix_message.foobar", "m.notice", "Welcome!"),
+					resource.TestCheckResourceAttr("matrix_message.foobar", "body", "Welcome!"),
+					resource.TestCheckResourceAttrSet("matrix_message.foobar", "event_id"),
+					func(s *terraform.State) error {
+						originalEventId = s.RootModule().Resources["matrix_message.foobar"].Primary.Attributes["event_id"]
+						return nil
+					},
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccMatrixMessageConfig_basic, room.RoomId, room.CreatorToken, "Welcome, everyone!", "Welcome, everyone!"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("matrix_message.foobar", "body", "Welcome, everyone!"),
+					func(s *terraform.State) error {
+						eventId := s.RootModule().Resources["matrix_message.foobar"].Primary.Attributes["event_id"]
+						if eventId != originalEventId {
+							return fmt.Errorf("event id changed after edit. expected: %s  got: %s", originalEventId, eventId)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckMatrixMessageDestroy(s *terraform.State) error {
+	meta := testAccProvider.Meta().(Metadata)
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "matrix_message" {
+			continue
+		}
+
+		event, err := getRoomEvent(meta, rs.Primary.Attributes["room_id"], rs.Primary.Attributes["event_id"], rs.Primary.Attributes["member_access_token"])
+		if err != nil {
+			return err
+		}
+		if event != nil && !isRedacted(event) {
+			return fmt.Errorf("message was not redacted")
+		}
+	}
+
+	return nil
+}
+
+func testAccCheckMatrixMessageContent(n string, msgtype string, body string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		meta := testAccProvider.Meta().(Metadata)
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("not found: %s", n)
+		}
+
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("record id not set")
+		}
+
+		event, err := getRoomEvent(meta, rs.Primary.Attributes["room_id"], rs.Primary.Attributes["event_id"], rs.Primary.Attributes["member_access_token"])
+		if err != nil {
+			return err
+		}
+		if event == nil {
+			return fmt.Errorf("message not found")
+		}
+
+		content := &api.RoomMessageEventContent{}
+		err = json.Unmarshal(event.Content, content)
+		if err != nil {
+			return err
+		}
+		if content.MsgType != msgtype || content.Body != body {
+			return fmt.Errorf("message mismatch. expected: %s %s  got: %s %s", msgtype, body, content.MsgType, content.Body)
+		}
+
+		return nil
+	}
+}
+
+func testUnitMessageServer(t *testing.T, edits *[]api.RoomEvent, txnIds map[string]bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/_matrix/client/r0/rooms/!room:localhost/send/m.room.message/"):
+			txnIds[r.URL.Path] = true
+			content, _ := ioutil.ReadAll(r.Body)
+			eventId := fmt.Sprintf("$edit%d", len(*edits))
+			*edits = append(*edits, api.RoomEvent{
+				Type:    "m.room.message",
+				EventId: eventId,
+				Sender:  "@alice:localhost",
+				Content: content,
+			})
+			w.Write([]byte(`{"event_id":"` + eventId + `"}`))
+		case r.Method == "GET" && r.URL.Path == "/_matrix/client/r0/rooms/!room:localhost/event/$original":
+			w.Write([]byte(`{"type":"m.room.message","event_id":"$original","sender":"@alice:localhost","content":{"msgtype":"m.text","body":"Hello"}}`))
+		case r.Method == "GET" && r.URL.Path == "/_matrix/client/v1/rooms/!room:localhost/relations/$original/m.replace":
+			if r.URL.Query().Get("dir") != "b" {
+				t.Errorf("expected the newest edits first, got dir: %s", r.URL.Query().Get("dir"))
+			}
+			response := &api.RelationsResponse{Chunk: make([]api.RoomEvent, 0)}
+			for i := len(*edits) - 1; i >= 0; i-- {
+				response.Chunk = append(response.Chunk, (*edits)[i])
+			}
+			json.NewEncoder(w).Encode(response)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestUnitMessageUpdate_sendsReplacement(t *testing.T) {
+	edits := make([]api.RoomEvent, 0)
+	txnIds := make(map[string]bool)
+	server := testUnitMessageServer(t, &edits, txnIds)
+	defer server.Close()
+
+	editCount := 0
+	update := func(body string) *schema.ResourceData {
+		d := schema.TestResourceDataRaw(t, resourceMessage().Schema, map[string]interface{}{
+			"room_id":             "!room:localhost",
+			"member_access_token": "member_token",
+			"body":                body,
+			"formatted_body":      "<b>" + body + "</b>",
+		})
+		d.SetId("!room:localhost/$original")
+		d.Set("event_id", "$original")
+		d.Set("txn_nonce", "0123456789abcdef")
+		d.Set("edit_count", editCount)
+
+		err := resourceMessageUpdate(d, Metadata{ClientApiUrl: server.URL})
+		if err != nil {
+			t.Errorf("unexpected error: %s", err)
+		}
+		if d.Get("event_id").(string) != "$original" {
+			t.Errorf("event id changed after edit: %s", d.Get("event_id"))
+		}
+		if d.Get("edit_count").(int) != editCount+1 {
+			t.Errorf("unexpected edit_count. expected: %d  got: %d", editCount+1, d.Get("edit_count"))
+		}
+		editCount = d.Get("edit_count").(int)
+		return d
+	}
+
+	// Going back to earlier content must still be sent, so every edit needs its own transaction
+	update("Hello, world")
+	update("Goodbye")
+	d := update("Hello, world")
+	if len(edits) != 3 || len(txnIds) != 3 {
+		t.Fatalf("unexpected number of edits. expected: %d  got: %d (%d transactions)", 3, len(edits), len(txnIds))
+	}
+	if d.Get("body").(string) != "Hello, world" {
+		t.Errorf("unexpected body after edits: %s", d.Get("body"))
+	}
+
+	content := api.RoomMessageEventContent{}
+	json.Unmarshal(edits[0].Content, &content)
+	if content.RelatesTo == nil || content.RelatesTo.RelationType != "m.replace" || content.RelatesTo.EventId != "$original" {
+		t.Errorf("unexpected relation: %#v", content.RelatesTo)
+	}
+	if content.Body != "* Hello, world" || content.FormattedBody != "* <b>Hello, world</b>" {
+		t.Errorf("unexpected fallback content: %#v", content)
+	}
+	if content.NewContent == nil || content.NewContent.Body != "Hello, world" || content.NewContent.Format != "org.matrix.custom.html" {
+		t.Errorf("unexpected new content: %#v", content.NewContent)
+	}
+}
+
+func TestUnitMessageRead_latestEdit(t *testing.T) {
+	edits := []api.RoomEvent{
+		{
+			Type:    "m.room.message",
+			EventId: "$edit0",
+			Sender:  "@alice:localhost",
+			Content: []byte(`{"msgtype":"m.notice","body":"* Edited","m.new_content":{"msgtype":"m.notice","body":"Edited"},"m.relates_to":{"rel_type":"m.replace","event_id":"$original"}}`),
+		},
+		{
+			// Edits from other senders are not valid, and the newest edit comes first
+			Type:    "m.room.message",
+			EventId: "$edit1",
+			Sender:  "@mallory:localhost",
+			Content: []byte(`{"msgtype":"m.text","body":"* Hijacked","m.new_content":{"msgtype":"m.text","body":"Hijacked"},"m.relates_to":{"rel_type":"m.replace","event_id":"$original"}}`),
+		},
+	}
+	server := testUnitMessageServer(t, &edits, make(map[string]bool))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceMessage().Schema, map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+		"body":                "Hello",
+		"formatted_body":      "<b>Hello</b>",
+	})
+	d.SetId("!room:localhost/$original")
+	d.Set("event_id", "$original")
+
+	err := resourceMessageRead(d, Metadata{ClientApiUrl: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if d.Get("body").(string) != "Edited" {
+		t.Errorf("unexpected body: %s", d.Get("body"))
+	}
+	if d.Get("msgtype").(string) != "m.notice" {
+		t.Errorf("unexpected msgtype: %s", d.Get("msgtype"))
+	}
+	if d.Get("formatted_body").(string) != "" {
+		t.Errorf("unexpected formatted_body: %s", d.Get("formatted_body"))
+	}
+}
+
+func TestUnitMessageRead_relationsUnsupported(t *testing.T) {
+	cases := []struct {
+		unstableEdits bool
+		expectedBody  string
+	}{
+		// Older servers only have the unstable relations API
+		{true, "Edited"},
+		// Servers without either are assumed to have no edits
+		{false, "Hello"},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/_matrix/client/r0/rooms/!room:localhost/event/$original":
+				w.Write([]byte(`{"type":"m.room.message","event_id":"$original","sender":"@alice:localhost","content":{"msgtype":"m.text","body":"Hello"}}`))
+			case r.Method == "GET" && r.URL.Path == "/_matrix/client/unstable/rooms/!room:localhost/relations/$original/m.replace" && c.unstableEdits:
+				w.Write([]byte(`{"chunk":[{"type":"m.room.message","event_id":"$edit0","sender":"@alice:localhost","content":{"msgtype":"m.text","body":"* Edited","m.new_content":{"msgtype":"m.text","body":"Edited"},"m.relates_to":{"rel_type":"m.replace","event_id":"$original"}}}]}`))
+			default:
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"errcode":"M_UNRECOGNIZED","error":"Unrecognized request"}`))
+			}
+		}))
+
+		d := schema.TestResourceDataRaw(t, resourceMessage().Schema, map[string]interface{}{
+			"room_id":             "!room:localhost",
+			"member_access_token": "member_token",
+			"body":                "Hello",
+		})
+		d.SetId("!room:localhost/$original")
+		d.Set("event_id", "$original")
+
+		err := resourceMessageRead(d, Metadata{ClientApiUrl: server.URL})
+		server.Close()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if d.Get("body").(string) != c.expectedBody {
+			t.Errorf("unexpected body. expected: %s  got: %s", c.expectedBody, d.Get("body"))
+		}
+	}
+}
@@ -2,11 +2,17 @@ package matrix
 
 import (
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/structure"
+	"github.com/hashicorp/terraform/helper/validation"
 	"fmt"
 	"log"
 	"github.com/turt2live/terraform-provider-matrix/matrix/api"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strings"
+	"time"
 )
 
 func resourceRoom() *schema.Resource {
@@ -17,6 +23,16 @@ func resourceRoom() *schema.Resource {
 		Update: resourceRoomUpdate,
 		Delete: resourceRoomDelete,
 
+		CustomizeDiff: resourceRoomCustomizeDiff,
+
+		Importer: &schema.ResourceImporter{
+			State: resourceRoomImport,
+		},
+
+		Timeouts: &schema.ResourceTimeout{
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"creator_user_id": {
 				Type:     schema.TypeString,
@@ -29,16 +45,18 @@ func resourceRoom() *schema.Resource {
 				Required: true,
 			},
 			"room_id": {
-				Type:     schema.TypeString,
-				Optional: true,
-				Computed: true,
-				ForceNew: true,
+				Type:             schema.TypeString,
+				Optional:         true,
+				Computed:         true,
+				ForceNew:         true,
+				DiffSuppressFunc: suppressUpgradedRoomIdDiff,
 			},
 			"preset": {
 				Type:     schema.TypeString,
 				Optional: true,
+				Computed: true,
 				ForceNew: true,
-				// Ignored if no creator
+				// Ignored if no creator. Computed so that imported rooms don't need it to be configured.
 			},
 			"name": {
 				Type:     schema.TypeString,
@@ -50,6 +68,21 @@ func resourceRoom() *schema.Resource {
 				Optional: true,
 				Computed: true,
 			},
+			"avatar_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"avatar_mxc"},
+				// Uploaded again whenever the file's contents change
+			},
+			"avatar_file_type": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// Defaults to a type based on the file extension
+			},
+			"avatar_file_sha256": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
 			"topic": {
 				Type:     schema.TypeString,
 				Optional: true,
@@ -61,18 +94,159 @@ func resourceRoom() *schema.Resource {
 					Type: schema.TypeString,
 				},
 				Optional: true,
+			},
+			"local_alias_localpart": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
+				ForceNew: true,
+				// Ignored if no creator. Computed so that imported rooms don't need it to be configured.
+			},
+			"guests_allowed": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				Computed: true,
+			},
+			"room_type": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Computed: true,
 				ForceNew: true,
 				// Ignored if no creator
 			},
-			"local_alias_localpart": {
+			"room_version": {
 				Type:     schema.TypeString,
 				Optional: true,
+				Computed: true,
+				// Changing this upgrades the room rather than creating a new one
+			},
+			"creation_content_json": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Computed:         true,
+				ForceNew:         true,
+				ValidateFunc:     validation.ValidateJsonString,
+				DiffSuppressFunc: suppressCreationContentDiff,
+				// Ignored if no creator
+			},
+			"initial_state": {
+				Type:     schema.TypeList,
+				Optional: true,
 				ForceNew: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"type": {
+							Type:         schema.TypeString,
+							Required:     true,
+							ForceNew:     true,
+							ValidateFunc: validation.NoZeroValues,
+						},
+						"state_key": {
+							Type:     schema.TypeString,
+							Optional: true,
+							Default:  "",
+							ForceNew: true,
+						},
+						"content_json": {
+							Type:             schema.TypeString,
+							Required:         true,
+							ForceNew:         true,
+							ValidateFunc:     validation.ValidateJsonString,
+							DiffSuppressFunc: structure.SuppressJsonDiff,
+						},
+					},
+				},
 				// Ignored if no creator
 			},
-			"guests_allowed": {
+			"server_acl": {
+				Type:     schema.TypeList,
+				Optional: true,
+				Computed: true,
+				MaxItems: 1,
+				// Allows `server_acl = []` to reset an ACL set by Terraform, as leaving it out keeps the room's ACL
+				ConfigMode: schema.SchemaConfigModeAttr,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"allow": {
+							Type: schema.TypeSet,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+							Set:      hashServerAclGlob,
+							Required: true,
+						},
+						"deny": {
+							Type: schema.TypeSet,
+							Elem: &schema.Schema{
+								Type: schema.TypeString,
+							},
+							Set:      hashServerAclGlob,
+							Optional: true,
+						},
+						"allow_ip_literals": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+					},
+				},
+			},
+			// Whether the room's ACL was set by Terraform, and so may be reset by it
+			"server_acl_managed": {
 				Type:     schema.TypeBool,
+				Computed: true,
+			},
+			"destroy_strategy": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "abandon",
+				ValidateFunc: validation.StringInSlice([]string{"leave_only", "abandon", "ban_all", "purge"}, false),
+			},
+			"purge_options": {
+				Type:     schema.TypeList,
 				Optional: true,
+				MaxItems: 1,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"block": {
+							Type:     schema.TypeBool,
+							Optional: true,
+						},
+						"purge_history": {
+							Type:     schema.TypeBool,
+							Optional: true,
+							Default:  true,
+						},
+						"new_room_user_id": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"new_room_name": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+						"message": {
+							Type:     schema.TypeString,
+							Optional: true,
+						},
+					},
+				},
+				// Ignored unless the destroy_strategy is purge
+			},
+			"predecessor_room_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"replacement_room_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			// Every room this one was upgraded from, oldest first
+			"previous_room_ids": {
+				Type: schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
 				Computed: true,
 			},
 		},
@@ -93,6 +267,8 @@ func resourceRoomCreate(d *schema.ResourceData, m interface{}) error {
 	aliasLocalpartRaw := d.Get("local_alias_localpart").(string)
 	guestsAllowed := d.Get("guests_allowed").(bool)
 	invitedUserIds := setOfStrings(d.Get("invite_user_ids").(*schema.Set))
+	roomVersion := d.Get("room_version").(string)
+	roomType := d.Get("room_type").(string)
 
 	hasCreator := creatorIdRaw != nil
 	hasRoomId := roomIdRaw != nil
@@ -105,12 +281,41 @@ func resourceRoomCreate(d *schema.ResourceData, m interface{}) error {
 		return fmt.Errorf("a creator or room_id must be specified")
 	}
 
+	if d.Get("avatar_file").(string) != "" {
+		avatarMxc, err := uploadAvatarFile(d, meta, memberAccessToken)
+		if err != nil {
+			return err
+		}
+		avatarMxcRaw = avatarMxc
+	}
+
 	if hasCreator {
 		log.Println("[DEBUG] Room creator set, creating room")
 		request := &api.CreateRoomRequest{
 			Preset:         presetRaw,
 			AliasLocalpart: aliasLocalpartRaw,
 			InviteUserIds:  invitedUserIds,
+			RoomVersion:    roomVersion,
+		}
+
+		creationContent := make(map[string]interface{})
+		if creationContentJson := d.Get("creation_content_json").(string); creationContentJson != "" {
+			log.Println("[DEBUG] Including creation content")
+			parsed, err := structure.ExpandJsonFromString(creationContentJson)
+			if err != nil {
+				return fmt.Errorf("error parsing creation content: %s", err)
+			}
+			creationContent = parsed
+		}
+		if roomType != "" {
+			if contentType, ok := creationContent["type"]; ok && contentType != roomType {
+				return fmt.Errorf("room_type conflicts with the type in creation_content_json")
+			}
+			log.Println("[DEBUG] Including room type in creation content:", roomType)
+			creationContent["type"] = roomType
+		}
+		if len(creationContent) > 0 {
+			request.CreationContent = creationContent
 		}
 
 		stateEvents := make([]api.CreateRoomStateEvent, 0)
@@ -148,6 +353,29 @@ func resourceRoomCreate(d *schema.ResourceData, m interface{}) error {
 				Content: api.RoomGuestAccessEventContent{Policy: "forbidden"},
 			})
 		}
+		if serverAcl := expandServerAcl(d.Get("server_acl").([]interface{})); serverAcl != nil {
+			log.Println("[DEBUG] Including room server ACL state event")
+			stateEvents = append(stateEvents, api.CreateRoomStateEvent{
+				Type:    "m.room.server_acl",
+				Content: serverAcl,
+			})
+			d.Set("server_acl_managed", true)
+		}
+		// Custom state goes last so it takes precedence over the events above
+		for _, v := range d.Get("initial_state").([]interface{}) {
+			initialState := v.(map[string]interface{})
+			content, err := structure.ExpandJsonFromString(initialState["content_json"].(string))
+			if err != nil {
+				return fmt.Errorf("error parsing initial state content for %s: %s", initialState["type"], err)
+			}
+
+			log.Println("[DEBUG] Including custom initial state event:", initialState["type"])
+			stateEvents = append(stateEvents, api.CreateRoomStateEvent{
+				Type:     initialState["type"].(string),
+				StateKey: initialState["state_key"].(string),
+				Content:  content,
+			})
+		}
 		request.InitialState = stateEvents
 
 		response := &api.RoomIdResponse{}
@@ -162,6 +390,36 @@ func resourceRoomCreate(d *schema.ResourceData, m interface{}) error {
 		d.Set("room_id", response.RoomId)
 	} else {
 		d.SetId(roomIdRaw.(string))
+
+		if d.Get("avatar_file").(string) != "" {
+			err := resourceRoomSetAvatar(d, meta, avatarMxcRaw.(string))
+			if err != nil {
+				return err
+			}
+		}
+
+		if serverAcl := expandServerAcl(d.Get("server_acl").([]interface{})); serverAcl != nil {
+			err := resourceRoomSetServerAcl(d, meta, serverAcl)
+			if err != nil {
+				return err
+			}
+			d.Set("server_acl_managed", true)
+		}
+
+		if roomVersion != "" {
+			err := resourceRoomUpgradeIfNeeded(d, meta)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The room may have been upgraded above, so the invites go to whichever room we ended up with
+		if len(invitedUserIds) > 0 {
+			err := resourceRoomUpdateInvites(d, meta, d.Id())
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return resourceRoomRead(d, meta)
@@ -178,31 +436,23 @@ func resourceRoomExists(d *schema.ResourceData, m interface{}) (bool, error) {
 		return false, nil
 	}
 
-	// First identify who the user is
-	log.Println("[DEBUG] Doing whoami on:", d.Id())
-	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/account/whoami")
-	whoAmIResponse := &api.WhoAmIResponse{}
-	err := api.DoRequest("GET", urlStr, nil, whoAmIResponse, memberAccessToken)
-	if err != nil {
-		// We say true so that Terraform won't accidentally delete the room
-		return true, fmt.Errorf("error performing whoami: %s", err)
-	}
-
-	// Now that we have user's ID, let's make sure they are a member
-	memberEventResponse := &api.RoomMemberEventContent{}
-	urlStr = api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms", roomIdRaw.(string), "/state/m.room.member/", whoAmIResponse.UserId)
+	// The joined rooms tell us whether the member is still in the room without needing to know who they are
+	joinedRoomsResponse := &api.JoinedRoomsResponse{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/joined_rooms")
 	log.Println("[DEBUG] Ensuring user is in room:", urlStr)
-	err = api.DoRequest("GET", urlStr, nil, memberEventResponse, memberAccessToken)
+	err := api.DoRequest("GET", urlStr, nil, joinedRoomsResponse, memberAccessToken)
 	if err != nil {
-		// An error accessing the room means it doesn't exist anymore
-		return false, fmt.Errorf("error getting member event for user: %s", err)
+		// We say true so that Terraform won't accidentally delete the room
+		return true, fmt.Errorf("error getting joined rooms: %s", err)
 	}
 
-	if memberEventResponse.Membership != "join" {
-		return false, fmt.Errorf("member is not in the room")
+	for _, roomId := range joinedRoomsResponse.RoomIds {
+		if roomId == roomIdRaw.(string) {
+			return true, nil
+		}
 	}
 
-	return true, nil
+	return false, fmt.Errorf("member is not in the room")
 }
 
 func resourceRoomRead(d *schema.ResourceData, m interface{}) error {
@@ -215,53 +465,73 @@ func resourceRoomRead(d *schema.ResourceData, m interface{}) error {
 		return fmt.Errorf("no room_id")
 	}
 
+	state, err := getRoomState(meta, roomIdRaw.(string), memberAccessToken)
+	if err != nil {
+		return err
+	}
+
 	nameResponse := &api.RoomNameEventContent{}
-	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomIdRaw.(string), "/state/m.room.name")
-	log.Println("[DEBUG] Getting room name:", urlStr)
-	err := api.DoRequest("GET", urlStr, nil, nameResponse, memberAccessToken)
+	_, err = state.get("m.room.name", "", nameResponse)
 	if err != nil {
-		if r, ok := err.(*api.ErrorResponse); !ok || r.StatusCode != http.StatusNotFound {
-			return fmt.Errorf("error getting room name: %s", err)
-		}
+		return err
 	}
 
 	avatarResponse := &api.RoomAvatarEventContent{}
-	urlStr = api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomIdRaw.(string), "/state/m.room.avatar")
-	log.Println("[DEBUG] Getting room avatar:", urlStr)
-	err = api.DoRequest("GET", urlStr, nil, avatarResponse, memberAccessToken)
+	_, err = state.get("m.room.avatar", "", avatarResponse)
 	if err != nil {
-		if r, ok := err.(*api.ErrorResponse); !ok || r.StatusCode != http.StatusNotFound {
-			return fmt.Errorf("error getting room avatar: %s", err)
-		}
+		return err
 	}
 
 	topicResponse := &api.RoomTopicEventContent{}
-	urlStr = api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomIdRaw.(string), "/state/m.room.topic")
-	log.Println("[DEBUG] Getting room topic:", urlStr)
-	err = api.DoRequest("GET", urlStr, nil, topicResponse, memberAccessToken)
+	_, err = state.get("m.room.topic", "", topicResponse)
 	if err != nil {
-		if r, ok := err.(*api.ErrorResponse); !ok || r.StatusCode != http.StatusNotFound {
-			return fmt.Errorf("error getting room topic: %s", err)
-		}
+		return err
 	}
 
 	guestResponse := &api.RoomGuestAccessEventContent{}
-	urlStr = api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomIdRaw.(string), "/state/m.room.guest_access")
-	log.Println("[DEBUG] Getting room guest access:", urlStr)
-	err = api.DoRequest("GET", urlStr, nil, guestResponse, memberAccessToken)
+	_, err = state.get("m.room.guest_access", "", guestResponse)
 	if err != nil {
-		if r, ok := err.(*api.ErrorResponse); !ok || r.StatusCode != http.StatusNotFound {
-			return fmt.Errorf("error getting room guest access policy: %s", err)
-		}
+		return err
 	}
 
 	creatorResponse := &api.RoomCreateEventContent{}
-	urlStr = api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomIdRaw.(string), "/state/m.room.create")
-	log.Println("[DEBUG] Getting room create event:", urlStr)
-	err = api.DoRequest("GET", urlStr, nil, creatorResponse, memberAccessToken)
+	_, err = state.get("m.room.create", "", creatorResponse)
+	if err != nil {
+		return err
+	}
+
+	creationContent := make(map[string]interface{})
+	_, err = state.get("m.room.create", "", &creationContent)
+	if err != nil {
+		return err
+	}
+
+	tombstoneResponse := &api.RoomTombstoneEventContent{}
+	_, err = state.get("m.room.tombstone", "", tombstoneResponse)
+	if err != nil {
+		return err
+	}
+
+	serverAclResponse := &api.RoomServerAclEventContent{}
+	hasServerAcl, err := state.get("m.room.server_acl", "", serverAclResponse)
 	if err != nil {
-		if r, ok := err.(*api.ErrorResponse); !ok || r.StatusCode != http.StatusNotFound {
-			return fmt.Errorf("error getting room creator: %s", err)
+		return err
+	}
+	if !hasServerAcl {
+		serverAclResponse = nil
+	}
+
+	// Only the invites we manage are read back, so invites sent by other means (such as by a matrix_room_member, or by
+	// people in the room) are left alone rather than being rescinded as drift
+	invitedUserIds := make([]string, 0)
+	for _, userId := range setOfStrings(d.Get("invite_user_ids").(*schema.Set)) {
+		// Accepted invites still count, otherwise they would be sent again
+		membership, err := state.membership(userId)
+		if err != nil {
+			return err
+		}
+		if membership == "invite" || membership == "join" {
+			invitedUserIds = append(invitedUserIds, userId)
 		}
 	}
 
@@ -269,6 +539,37 @@ func resourceRoomRead(d *schema.ResourceData, m interface{}) error {
 	d.Set("avatar_mxc", avatarResponse.AvatarMxc)
 	d.Set("topic", topicResponse.Topic)
 	d.Set("creator_user_id", creatorResponse.CreatorUserId)
+	d.Set("invite_user_ids", invitedUserIds)
+
+	// Rooms without a version in their create event are implicitly version 1
+	roomVersion := creatorResponse.RoomVersion
+	if roomVersion == "" {
+		roomVersion = "1"
+	}
+	d.Set("room_version", roomVersion)
+	d.Set("room_type", creatorResponse.RoomType)
+
+	// The server fills these in itself, and they are already exposed as their own attributes
+	delete(creationContent, "creator")
+	delete(creationContent, "room_version")
+	delete(creationContent, "predecessor")
+	creationContentJson, err := structure.FlattenJsonToString(creationContent)
+	if err != nil {
+		return fmt.Errorf("error serializing creation content: %s", err)
+	}
+	d.Set("creation_content_json", creationContentJson)
+
+	if creatorResponse.Predecessor != nil {
+		d.Set("predecessor_room_id", creatorResponse.Predecessor.RoomId)
+	} else {
+		d.Set("predecessor_room_id", "")
+	}
+	d.Set("replacement_room_id", tombstoneResponse.ReplacementRoomId)
+	if isPermissiveServerAcl(serverAclResponse) && len(d.Get("server_acl").([]interface{})) == 0 {
+		// This is what a reset ACL looks like, so it stays reset unless it was configured this way
+		serverAclResponse = nil
+	}
+	d.Set("server_acl", flattenServerAcl(serverAclResponse))
 
 	if guestResponse.Policy == "can_join" {
 		d.Set("guests_allowed", true)
@@ -283,6 +584,15 @@ func resourceRoomUpdate(d *schema.ResourceData, m interface{}) error {
 	meta := m.(Metadata)
 
 	memberAccessToken := d.Get("member_access_token").(string)
+
+	if d.HasChange("room_version") {
+		err := resourceRoomUpgradeIfNeeded(d, meta)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Read the room ID after upgrading so the changes below apply to the replacement room
 	roomIdRaw := nilIfEmptyString(d.Get("room_id"))
 
 	if roomIdRaw == nil {
@@ -300,12 +610,15 @@ func resourceRoomUpdate(d *schema.ResourceData, m interface{}) error {
 		}
 	}
 
+	if avatarFileChanged(d) {
+		_, err := uploadAvatarFile(d, meta, memberAccessToken)
+		if err != nil {
+			return err
+		}
+	}
+
 	if d.HasChange("avatar_mxc") {
-		request := &api.RoomAvatarEventContent{AvatarMxc: d.Get("avatar_mxc").(string)}
-		response := &api.EventIdResponse{}
-		urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms", roomIdRaw.(string), "/state/m.room.avatar")
-		log.Println("[DEBUG] Updating room avatar:", urlStr)
-		err := api.DoRequest("PUT", urlStr, request, response, memberAccessToken)
+		err := resourceRoomSetAvatar(d, meta, d.Get("avatar_mxc").(string))
 		if err != nil {
 			return err
 		}
@@ -322,6 +635,28 @@ func resourceRoomUpdate(d *schema.ResourceData, m interface{}) error {
 		}
 	}
 
+	if d.HasChange("server_acl") {
+		serverAcl := expandServerAcl(d.Get("server_acl").([]interface{}))
+		if serverAcl == nil {
+			// State events can't be removed, so the closest we can get is an ACL which allows everyone. The diff
+			// makes sure only an ACL set by Terraform gets here.
+			log.Println("[DEBUG] Server ACL reset, allowing all servers")
+			serverAcl = permissiveServerAcl()
+		}
+		err := resourceRoomSetServerAcl(d, meta, serverAcl)
+		if err != nil {
+			return err
+		}
+		d.Set("server_acl_managed", expandServerAcl(d.Get("server_acl").([]interface{})) != nil)
+	}
+
+	if d.HasChange("invite_user_ids") {
+		err := resourceRoomUpdateInvites(d, meta, roomIdRaw.(string))
+		if err != nil {
+			return err
+		}
+	}
+
 	if d.HasChange("guests_allowed") {
 		policy := "forbidden"
 		if d.Get("guests_allowed").(bool) {
@@ -340,11 +675,403 @@ func resourceRoomUpdate(d *schema.ResourceData, m interface{}) error {
 	return nil
 }
 
+func resourceRoomSetAvatar(d *schema.ResourceData, meta Metadata, avatarMxc string) error {
+	request := &api.RoomAvatarEventContent{AvatarMxc: avatarMxc}
+	response := &api.EventIdResponse{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms", d.Get("room_id").(string), "/state/m.room.avatar")
+	log.Println("[DEBUG] Updating room avatar:", urlStr)
+	err := api.DoRequest("PUT", urlStr, request, response, d.Get("member_access_token").(string))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func resourceRoomUpdateInvites(d *schema.ResourceData, meta Metadata, roomId string) error {
+	memberAccessToken := d.Get("member_access_token").(string)
+	oldRaw, newRaw := d.GetChange("invite_user_ids")
+	oldInvites := oldRaw.(*schema.Set)
+	newInvites := newRaw.(*schema.Set)
+
+	state, err := getRoomState(meta, roomId, memberAccessToken)
+	if err != nil {
+		return err
+	}
+
+	for _, userId := range setOfStrings(newInvites.Difference(oldInvites)) {
+		membership, err := state.membership(userId)
+		if err != nil {
+			return err
+		}
+		if membership == "invite" || membership == "join" {
+			continue
+		}
+
+		err = doRoomInvite(meta, roomId, userId, memberAccessToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, userId := range setOfStrings(oldInvites.Difference(newInvites)) {
+		membership, err := state.membership(userId)
+		if err != nil {
+			return err
+		}
+		if membership != "invite" {
+			// Users who already accepted their invite are left in the room
+			continue
+		}
+
+		// Kicking an invited user rescinds their invite
+		err = doRoomKick(meta, roomId, userId, "Invite rescinded", memberAccessToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceRoomImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	meta := m.(Metadata)
+
+	if meta.DefaultAccessToken == "" {
+		return nil, fmt.Errorf("a default access token is required to import rooms")
+	}
+
+	roomId := d.Id()
+	if strings.HasPrefix(roomId, "#") {
+		response := &api.RoomDirectoryLookupResponse{}
+		urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/directory/room/", url.QueryEscape(roomId))
+		log.Println("[DEBUG] Resolving room alias:", urlStr)
+		err := api.DoRequest("GET", urlStr, nil, response, meta.DefaultAccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving room alias %s: %s", roomId, err)
+		}
+		roomId = response.RoomId
+	}
+
+	d.SetId(roomId)
+	d.Set("room_id", roomId)
+	d.Set("member_access_token", meta.DefaultAccessToken)
+
+	// The creation settings aren't kept by the room, so we work them out from its state instead
+	state, err := getRoomState(meta, roomId, meta.DefaultAccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	joinRulesContent := &api.RoomJoinRulesEventContent{}
+	_, err = state.get("m.room.join_rules", "", joinRulesContent)
+	if err != nil {
+		return nil, err
+	}
+	if joinRulesContent.Policy == "public" {
+		d.Set("preset", "public_chat")
+	}
+	// Private and trusted private chats only differ by the power levels of the invitees, so we can't tell which was
+	// used and leave the preset unset rather than guessing
+
+	canonicalAliasContent := &api.RoomCanonicalAliasEventContent{}
+	_, err = state.get("m.room.canonical_alias", "", canonicalAliasContent)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(canonicalAliasContent.Alias, "#") && strings.Contains(canonicalAliasContent.Alias, ":") {
+		log.Println("[DEBUG] Performing whoami on default access token")
+		whoAmIResponse := &api.WhoAmIResponse{}
+		urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/account/whoami")
+		err = api.DoRequest("GET", urlStr, nil, whoAmIResponse, meta.DefaultAccessToken)
+		if err != nil {
+			return nil, fmt.Errorf("error performing whoami: %s", err)
+		}
+		hsDomain, err := getDomainName(whoAmIResponse.UserId)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing user id: %s", err)
+		}
+
+		// Rooms are only given local aliases on the creator's own server, so aliases on other servers aren't ours
+		aliasDomain := canonicalAliasContent.Alias[strings.Index(canonicalAliasContent.Alias, ":")+1:]
+		if aliasDomain == hsDomain {
+			d.Set("local_alias_localpart", canonicalAliasContent.Alias[1:strings.Index(canonicalAliasContent.Alias, ":")])
+		}
+	}
+
+	invitedUserIds, err := state.members("invite")
+	if err != nil {
+		return nil, err
+	}
+	d.Set("invite_user_ids", invitedUserIds)
+
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourceRoomCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	meta := m.(Metadata)
+
+	err := resourceRoomCustomizeDiffServerAcl(d, meta)
+	if err != nil {
+		return err
+	}
+
+	err = customizeDiffAvatarFile(d)
+	if err != nil {
+		return err
+	}
+
+	roomVersion := d.Get("room_version").(string)
+	if !d.HasChange("room_version") || roomVersion == "" {
+		return nil
+	}
+
+	if !d.NewValueKnown("member_access_token") {
+		// The version gets checked by the server when the room is created instead
+		log.Println("[DEBUG] Member access token not yet known, skipping room version validation")
+		return nil
+	}
+
+	accessToken := d.Get("member_access_token").(string)
+	if accessToken == "" {
+		accessToken = meta.DefaultAccessToken
+	}
+
+	response := &api.CapabilitiesResponse{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/capabilities")
+	log.Println("[DEBUG] Getting server capabilities:", urlStr)
+	err = api.DoRequest("GET", urlStr, nil, response, accessToken)
+	if err != nil {
+		return fmt.Errorf("error getting server capabilities: %s", err)
+	}
+
+	if response.Capabilities.RoomVersions == nil {
+		log.Println("[DEBUG] Server did not advertise room versions, skipping room version validation")
+		return nil
+	}
+	if _, ok := response.Capabilities.RoomVersions.Available[roomVersion]; !ok {
+		return fmt.Errorf("room version %s is not supported by the server", roomVersion)
+	}
+
+	return nil
+}
+
+func resourceRoomCustomizeDiffServerAcl(d *schema.ResourceDiff, meta Metadata) error {
+	// HasChange compares the sets inside the block by pointer, so compare the ACLs themselves instead
+	oldRaw, newRaw := d.GetChange("server_acl")
+	serverAcl := expandServerAcl(newRaw.([]interface{}))
+	if reflect.DeepEqual(expandServerAcl(oldRaw.([]interface{})), serverAcl) {
+		return nil
+	}
+	if serverAcl == nil {
+		// An ACL set outside of Terraform might be keeping abusive servers out, so it is never reset
+		if !d.Get("server_acl_managed").(bool) {
+			return fmt.Errorf("server_acl was not set by Terraform and won't be reset. Remove `server_acl = []` to leave it as-is")
+		}
+		return nil
+	}
+
+	// The member access token is what manages the room, so its server must not be locked out of the room
+	if !d.NewValueKnown("member_access_token") || d.Get("member_access_token").(string) == "" {
+		log.Println("[DEBUG] Member access token not yet known, skipping server ACL validation")
+		return nil
+	}
+
+	log.Println("[DEBUG] Performing whoami on member access token")
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/account/whoami")
+	whoAmIResponse := &api.WhoAmIResponse{}
+	err := api.DoRequest("GET", urlStr, nil, whoAmIResponse, d.Get("member_access_token").(string))
+	if err != nil {
+		return fmt.Errorf("error performing whoami: %s", err)
+	}
+
+	hsDomain, err := getDomainName(whoAmIResponse.UserId)
+	if err != nil {
+		return fmt.Errorf("error parsing user id: %s", err)
+	}
+
+	if !serverAclAllowsServer(serverAcl.Allow, serverAcl.Deny, *serverAcl.AllowIpLiterals, hsDomain) {
+		return fmt.Errorf("server_acl would lock %s out of the room", hsDomain)
+	}
+
+	return nil
+}
+
+func resourceRoomSetServerAcl(d *schema.ResourceData, meta Metadata, serverAcl *api.RoomServerAclEventContent) error {
+	memberAccessToken := d.Get("member_access_token").(string)
+
+	response := &api.EventIdResponse{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms", d.Id(), "/state/m.room.server_acl")
+	log.Println("[DEBUG] Updating room server ACL:", urlStr)
+	err := api.DoRequest("PUT", urlStr, serverAcl, response, memberAccessToken)
+	if err != nil {
+		return fmt.Errorf("error updating room server ACL: %s", err)
+	}
+
+	return nil
+}
+
+func expandServerAcl(raw []interface{}) *api.RoomServerAclEventContent {
+	if len(raw) == 0 || raw[0] == nil {
+		return nil
+	}
+
+	block := raw[0].(map[string]interface{})
+	allowIpLiterals := block["allow_ip_literals"].(bool)
+	serverAcl := &api.RoomServerAclEventContent{
+		Allow:           make([]string, 0),
+		Deny:            make([]string, 0),
+		AllowIpLiterals: &allowIpLiterals,
+	}
+	for _, glob := range setOfStrings(block["allow"].(*schema.Set)) {
+		serverAcl.Allow = append(serverAcl.Allow, normalizeServerAclGlob(glob))
+	}
+	if deny, ok := block["deny"].(*schema.Set); ok {
+		for _, glob := range setOfStrings(deny) {
+			serverAcl.Deny = append(serverAcl.Deny, normalizeServerAclGlob(glob))
+		}
+	}
+
+	return serverAcl
+}
+
+func permissiveServerAcl() *api.RoomServerAclEventContent {
+	allowIpLiterals := true
+	return &api.RoomServerAclEventContent{
+		Allow:           []string{"*"},
+		Deny:            make([]string, 0),
+		AllowIpLiterals: &allowIpLiterals,
+	}
+}
+
+// isPermissiveServerAcl returns true if the ACL allows every server, as if there was no ACL at all
+func isPermissiveServerAcl(serverAcl *api.RoomServerAclEventContent) bool {
+	if serverAcl == nil {
+		return true
+	}
+	if len(serverAcl.Deny) > 0 || (serverAcl.AllowIpLiterals != nil && !*serverAcl.AllowIpLiterals) {
+		return false
+	}
+	for _, glob := range serverAcl.Allow {
+		if glob == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func flattenServerAcl(serverAcl *api.RoomServerAclEventContent) []interface{} {
+	if serverAcl == nil {
+		return []interface{}{}
+	}
+
+	// The spec says a missing allow_ip_literals means they are allowed
+	allowIpLiterals := true
+	if serverAcl.AllowIpLiterals != nil {
+		allowIpLiterals = *serverAcl.AllowIpLiterals
+	}
+
+	allow := make([]interface{}, 0)
+	for _, glob := range serverAcl.Allow {
+		allow = append(allow, normalizeServerAclGlob(glob))
+	}
+	deny := make([]interface{}, 0)
+	for _, glob := range serverAcl.Deny {
+		deny = append(deny, normalizeServerAclGlob(glob))
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"allow":             schema.NewSet(hashServerAclGlob, allow),
+			"deny":              schema.NewSet(hashServerAclGlob, deny),
+			"allow_ip_literals": allowIpLiterals,
+		},
+	}
+}
+
+func suppressCreationContentDiff(k, old, new string, d *schema.ResourceData) bool {
+	oldContent, err := structure.ExpandJsonFromString(old)
+	if err != nil {
+		return false
+	}
+	newContent, err := structure.ExpandJsonFromString(new)
+	if err != nil {
+		return false
+	}
+
+	// The type is normally managed through room_type, so it only counts if it was specified here too
+	if _, ok := newContent["type"]; !ok {
+		delete(oldContent, "type")
+	}
+
+	return reflect.DeepEqual(oldContent, newContent)
+}
+
+func resourceRoomUpgradeIfNeeded(d *schema.ResourceData, meta Metadata) error {
+	memberAccessToken := d.Get("member_access_token").(string)
+	roomId := d.Id()
+	newVersion := d.Get("room_version").(string)
+
+	creatorResponse := &api.RoomCreateEventContent{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/state/m.room.create")
+	log.Println("[DEBUG] Getting room create event:", urlStr)
+	err := api.DoRequest("GET", urlStr, nil, creatorResponse, memberAccessToken)
+	if err != nil {
+		return fmt.Errorf("error getting room create event: %s", err)
+	}
+	if creatorResponse.RoomVersion == newVersion || (creatorResponse.RoomVersion == "" && newVersion == "1") {
+		log.Println("[DEBUG] Room is already version", newVersion)
+		return nil
+	}
+
+	request := &api.RoomUpgradeRequest{NewVersion: newVersion}
+	response := &api.RoomUpgradeResponse{}
+	urlStr = api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/upgrade")
+	log.Println("[DEBUG] Upgrading room:", urlStr)
+	err = api.DoRequest("POST", urlStr, request, response, memberAccessToken)
+	if err != nil {
+		return fmt.Errorf("error upgrading room: %s", err)
+	}
+
+	log.Println("[DEBUG] Room", roomId, "was replaced by", response.ReplacementRoomId)
+	d.SetId(response.ReplacementRoomId)
+	d.Set("room_id", response.ReplacementRoomId)
+	d.Set("predecessor_room_id", roomId)
+	d.Set("previous_room_ids", append(d.Get("previous_room_ids").([]interface{}), roomId))
+	return nil
+}
+
+// suppressUpgradedRoomIdDiff keeps a configured room_id from creating a new room once the room has been upgraded
+// (possibly several times) and replaced by a room with a new ID. Only upgrades performed by Terraform are known here.
+func suppressUpgradedRoomIdDiff(k, old, new string, d *schema.ResourceData) bool {
+	if new == "" {
+		return false
+	}
+	if new == d.Get("predecessor_room_id").(string) {
+		return true
+	}
+	for _, roomId := range d.Get("previous_room_ids").([]interface{}) {
+		if new == roomId.(string) {
+			return true
+		}
+	}
+	return false
+}
+
 func resourceRoomDelete(d *schema.ResourceData, m interface{}) error {
 	meta := m.(Metadata)
 
 	memberAccessToken := d.Get("member_access_token").(string)
 	roomId := nilIfEmptyString(d.Get("room_id")).(string)
+	destroyStrategy := d.Get("destroy_strategy").(string)
+
+	switch destroyStrategy {
+	case "leave_only":
+		log.Println("[DEBUG] Leaving room without abandoning it")
+		return resourceRoomLeave(meta, roomId, memberAccessToken)
+	case "purge":
+		return resourceRoomPurge(d, meta)
+	}
 
 	log.Println("[DEBUG] Performing whoami on member access token")
 	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/account/whoami")
@@ -402,15 +1129,12 @@ func resourceRoomDelete(d *schema.ResourceData, m interface{}) error {
 		return fmt.Errorf("error disabling guest access: %s", err)
 	}
 
-	// Kick everyone
-	membersResponse := &api.RoomMembersResponse{}
-	urlStr = api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/members")
-	log.Println("[DEBUG] Getting room members:", urlStr)
-	err = api.DoRequest("GET", urlStr, nil, membersResponse, memberAccessToken)
+	// Kick (or ban) everyone
+	members, err := getRoomMembers(meta, roomId, memberAccessToken)
 	if err != nil {
-		return fmt.Errorf("error getting membership list: %s", err)
+		return err
 	}
-	for _, member := range membersResponse.Chunk {
+	for _, member := range members {
 		if member.Content == nil {
 			return fmt.Errorf("member %s has no content in their member event", member.StateKey)
 		}
@@ -420,7 +1144,12 @@ func resourceRoomDelete(d *schema.ResourceData, m interface{}) error {
 			continue
 		}
 
-		if member.Content.Membership == "invite" || member.Content.Membership == "join" {
+		if destroyStrategy == "ban_all" && member.Content.Membership != "ban" {
+			err = doRoomBan(meta, roomId, member.StateKey, "This room is being deleted in Terraform", memberAccessToken)
+			if err != nil {
+				return err
+			}
+		} else if member.Content.Membership == "invite" || member.Content.Membership == "join" {
 			kickRequest := &api.KickRequest{
 				UserId: member.StateKey,
 				Reason: "This room is being deleted in Terraform",
@@ -434,12 +1163,17 @@ func resourceRoomDelete(d *schema.ResourceData, m interface{}) error {
 		}
 	}
 
+	// Note: We can't do anything about the room's history, so we leave that untouched.
+	return resourceRoomLeave(meta, roomId, memberAccessToken)
+}
+
+func resourceRoomLeave(meta Metadata, roomId string, memberAccessToken string) error {
 	// Leave (forget) the room
 	// The spec says we should be able to forget and have that leave us, however this isn't what synapse
 	// does in practice: https://github.com/matrix-org/matrix-doc/issues/1011
-	urlStr = api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/leave")
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/leave")
 	log.Println("[DEBUG] Leaving room:", urlStr)
-	err = api.DoRequest("POST", urlStr, nil, nil, memberAccessToken)
+	err := api.DoRequest("POST", urlStr, nil, nil, memberAccessToken)
 	if err != nil {
 		return fmt.Errorf("error leaving the room: %s", err)
 	}
@@ -450,6 +1184,61 @@ func resourceRoomDelete(d *schema.ResourceData, m interface{}) error {
 		return fmt.Errorf("error forgetting the room: %s", err)
 	}
 
-	// Note: We can't do anything about the room's history, so we leave that untouched.
 	return nil
 }
+
+func resourceRoomPurge(d *schema.ResourceData, meta Metadata) error {
+	roomId := d.Get("room_id").(string)
+
+	if meta.AdminAccessToken == "" {
+		return fmt.Errorf("an admin access token is required to purge rooms")
+	}
+
+	request := &api.AdminDeleteRoomRequest{
+		Purge: true,
+	}
+	if raw := d.Get("purge_options").([]interface{}); len(raw) > 0 && raw[0] != nil {
+		options := raw[0].(map[string]interface{})
+		request.Block = options["block"].(bool)
+		request.Purge = options["purge_history"].(bool)
+		request.NewRoomUserId = options["new_room_user_id"].(string)
+		request.RoomName = options["new_room_name"].(string)
+		request.Message = options["message"].(string)
+	}
+
+	response := &api.AdminDeleteRoomResponse{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_synapse/admin/v2/rooms/", url.PathEscape(roomId))
+	log.Println("[DEBUG] Deleting room:", urlStr)
+	err := api.DoRequest("DELETE", urlStr, request, response, meta.AdminAccessToken)
+	if err != nil {
+		if r, ok := err.(*api.ErrorResponse); ok && (r.StatusCode == http.StatusNotFound || r.ErrorCode == api.ErrCodeUnrecognized) {
+			// Older versions of Synapse only have the v1 API, which deletes the room before responding
+			urlStr = api.MakeUrl(meta.ClientApiUrl, "/_synapse/admin/v1/rooms/", url.PathEscape(roomId), "/delete")
+			log.Println("[DEBUG] Room delete v2 API not supported, deleting room:", urlStr)
+			err = api.DoRequest("POST", urlStr, request, nil, meta.AdminAccessToken)
+			if err != nil {
+				return fmt.Errorf("error deleting room: %s", err)
+			}
+			return nil
+		}
+		return fmt.Errorf("error deleting room: %s", err)
+	}
+
+	return resource.Retry(d.Timeout(schema.TimeoutDelete), func() *resource.RetryError {
+		statusResponse := &api.AdminDeleteRoomStatusResponse{}
+		urlStr := api.MakeUrl(meta.ClientApiUrl, "/_synapse/admin/v2/rooms/delete_status/", url.PathEscape(response.DeleteId))
+		log.Println("[DEBUG] Getting room delete status:", urlStr)
+		err := api.DoRequest("GET", urlStr, nil, statusResponse, meta.AdminAccessToken)
+		if err != nil {
+			return resource.NonRetryableError(fmt.Errorf("error getting room delete status: %s", err))
+		}
+
+		switch statusResponse.Status {
+		case "complete":
+			return nil
+		case "failed":
+			return resource.NonRetryableError(fmt.Errorf("error deleting room: %s", statusResponse.Error))
+		}
+		return resource.RetryableError(fmt.Errorf("room delete is still in progress: %s", statusResponse.Status))
+	})
+}
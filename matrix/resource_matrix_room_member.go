@@ -0,0 +1,362 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"net/http"
+	"strings"
+)
+
+func resourceRoomMember() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceRoomMemberCreate,
+		Read:   resourceRoomMemberRead,
+		Update: resourceRoomMemberUpdate,
+		Delete: resourceRoomMemberDelete,
+
+		Importer: &schema.ResourceImporter{
+			State: resourceRoomMemberImport,
+		},
+
+		Schema: map[string]*schema.Schema{
+			"room_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"user_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"membership": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validation.StringInSlice([]string{"invite", "join", "ban", "leave"}, false),
+			},
+			"reason": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"member_access_token": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// Only used to join the room on behalf of the member
+			},
+			"admin_access_token": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// Defaults to the provider's default access token
+			},
+		},
+	}
+}
+
+func resourceRoomMemberCreate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	roomId := d.Get("room_id").(string)
+	userId := d.Get("user_id").(string)
+
+	err := resourceRoomMemberApply(d, meta)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(makeRoomMemberId(roomId, userId))
+	return resourceRoomMemberRead(d, meta)
+}
+
+func resourceRoomMemberRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	roomId := d.Get("room_id").(string)
+	userId := d.Get("user_id").(string)
+	desired := d.Get("membership").(string)
+	readToken := resourceRoomMemberReadToken(d, meta)
+
+	member, err := getRoomMemberEvent(meta, roomId, userId, readToken)
+	if err != nil || member.Content.Membership == "leave" {
+		// A room which is gone or can't be seen looks the same as a user who was never in it, so check the room itself
+		visible, visibleErr := isRoomVisible(meta, roomId, readToken)
+		if visibleErr != nil {
+			return visibleErr
+		}
+		if !visible {
+			log.Println("[DEBUG] Room not found or not visible, considering the membership deleted")
+			d.SetId("")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	membership := member.Content.Membership
+	if desired == "invite" && membership == "join" {
+		// The user accepted the invite, which is what we were after
+		membership = "invite"
+	}
+
+	d.Set("membership", membership)
+	return nil
+}
+
+func resourceRoomMemberUpdate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	if d.HasChange("membership") {
+		err := resourceRoomMemberApply(d, meta)
+		if err != nil {
+			return err
+		}
+	}
+
+	return resourceRoomMemberRead(d, meta)
+}
+
+func resourceRoomMemberDelete(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	roomId := d.Get("room_id").(string)
+	userId := d.Get("user_id").(string)
+	reason := d.Get("reason").(string)
+	adminToken := resourceRoomMemberAdminToken(d, meta)
+
+	member, err := getRoomMemberEvent(meta, roomId, userId, resourceRoomMemberReadToken(d, meta))
+	if err != nil {
+		return err
+	}
+
+	switch member.Content.Membership {
+	case "ban":
+		return doRoomUnban(meta, roomId, userId, adminToken)
+	case "invite", "join":
+		if reason == "" {
+			reason = "This membership is being deleted in Terraform"
+		}
+		return doRoomKick(meta, roomId, userId, reason, adminToken)
+	}
+
+	return nil
+}
+
+func resourceRoomMemberImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	// Neither room nor user IDs can contain a slash, so the ID splits cleanly
+	parts := strings.SplitN(d.Id(), "/", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "!") || !strings.HasPrefix(parts[1], "@") {
+		return nil, fmt.Errorf("expected an ID of the form room_id/user_id, got: %s", d.Id())
+	}
+
+	d.SetId(makeRoomMemberId(parts[0], parts[1]))
+	d.Set("room_id", parts[0])
+	d.Set("user_id", parts[1])
+
+	return []*schema.ResourceData{d}, nil
+}
+
+func resourceRoomMemberApply(d *schema.ResourceData, meta Metadata) error {
+	roomId := d.Get("room_id").(string)
+	userId := d.Get("user_id").(string)
+	desired := d.Get("membership").(string)
+	reason := d.Get("reason").(string)
+	memberToken := d.Get("member_access_token").(string)
+	adminToken := resourceRoomMemberAdminToken(d, meta)
+
+	member, err := getRoomMemberEvent(meta, roomId, userId, resourceRoomMemberReadToken(d, meta))
+	if err != nil {
+		return err
+	}
+	current := member.Content.Membership
+
+	log.Println("[DEBUG] Changing membership of", userId, "in", roomId, "from", current, "to", desired)
+	if current == desired {
+		return nil
+	}
+
+	if current == "ban" {
+		// Everything other than a ban requires the user to be unbanned first
+		err = doRoomUnban(meta, roomId, userId, adminToken)
+		if err != nil {
+			return err
+		}
+		current = "leave"
+	}
+
+	switch desired {
+	case "invite":
+		if current == "join" {
+			// Already past the invite stage
+			return nil
+		}
+		return doRoomInvite(meta, roomId, userId, adminToken)
+	case "join":
+		if memberToken == "" {
+			return fmt.Errorf("a member_access_token is required to join %s to the room", userId)
+		}
+
+		whoAmIResponse := &api.WhoAmIResponse{}
+		urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/account/whoami")
+		log.Println("[DEBUG] Performing whoami on member access token")
+		err = api.DoRequest("GET", urlStr, nil, whoAmIResponse, memberToken)
+		if err != nil {
+			return fmt.Errorf("error performing whoami: %s", err)
+		}
+		if whoAmIResponse.UserId != userId {
+			return fmt.Errorf("member_access_token belongs to %s, not %s", whoAmIResponse.UserId, userId)
+		}
+
+		err = doRoomJoin(meta, roomId, memberToken)
+		if err != nil && current != "invite" && adminToken != "" {
+			// The room might be invite only, so try inviting the user before joining again
+			log.Println("[DEBUG] Join failed, inviting before trying again:", err)
+			err = doRoomInvite(meta, roomId, userId, adminToken)
+			if err != nil {
+				return err
+			}
+			err = doRoomJoin(meta, roomId, memberToken)
+		}
+		return err
+	case "ban":
+		return doRoomBan(meta, roomId, userId, reason, adminToken)
+	case "leave":
+		if current == "join" && memberToken != "" {
+			urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/leave")
+			log.Println("[DEBUG] Leaving room:", urlStr)
+			err = api.DoRequest("POST", urlStr, nil, nil, memberToken)
+			if err != nil {
+				return fmt.Errorf("error leaving the room: %s", err)
+			}
+			return nil
+		}
+		if current == "join" || current == "invite" {
+			return doRoomKick(meta, roomId, userId, reason, adminToken)
+		}
+	}
+
+	return nil
+}
+
+func resourceRoomMemberAdminToken(d *schema.ResourceData, meta Metadata) string {
+	adminToken := d.Get("admin_access_token").(string)
+	if adminToken == "" {
+		adminToken = meta.DefaultAccessToken
+	}
+	return adminToken
+}
+
+func resourceRoomMemberReadToken(d *schema.ResourceData, meta Metadata) string {
+	token := resourceRoomMemberAdminToken(d, meta)
+	if token == "" {
+		token = d.Get("member_access_token").(string)
+	}
+	return token
+}
+
+func makeRoomMemberId(roomId string, userId string) string {
+	return fmt.Sprintf("%s/%s", roomId, userId)
+}
+
+func isRoomVisible(meta Metadata, roomId string, accessToken string) (bool, error) {
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/state/m.room.create")
+	log.Println("[DEBUG] Checking to see if the room is visible:", urlStr)
+	err := api.DoRequest("GET", urlStr, nil, &api.RoomCreateEventContent{}, accessToken)
+	if err != nil {
+		if r, ok := err.(*api.ErrorResponse); ok && (r.StatusCode == http.StatusNotFound || r.StatusCode == http.StatusForbidden) {
+			return false, nil
+		}
+		return false, fmt.Errorf("error getting room create event: %s", err)
+	}
+	return true, nil
+}
+
+func getRoomMemberEvent(meta Metadata, roomId string, userId string, accessToken string) (*api.RoomMemberEvent, error) {
+	content := &api.RoomMemberEventContent{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/state/m.room.member/", userId)
+	log.Println("[DEBUG] Getting room member:", urlStr)
+	err := api.DoRequest("GET", urlStr, nil, content, accessToken)
+	if err != nil {
+		if r, ok := err.(*api.ErrorResponse); !ok || r.StatusCode != http.StatusNotFound {
+			return nil, fmt.Errorf("error getting member event for %s: %s", userId, err)
+		}
+
+		// No member event means the user has never been in the room
+		content.Membership = "leave"
+	}
+
+	return &api.RoomMemberEvent{
+		Content:  content,
+		Type:     "m.room.member",
+		RoomId:   roomId,
+		StateKey: userId,
+	}, nil
+}
+
+func getRoomMembers(meta Metadata, roomId string, accessToken string) ([]api.RoomMemberEvent, error) {
+	response := &api.RoomMembersResponse{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/members")
+	log.Println("[DEBUG] Getting room members:", urlStr)
+	err := api.DoRequest("GET", urlStr, nil, response, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("error getting membership list: %s", err)
+	}
+	return response.Chunk, nil
+}
+
+func doRoomJoin(meta Metadata, roomId string, accessToken string) error {
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/join")
+	log.Println("[DEBUG] Joining room:", urlStr)
+	err := api.DoRequest("POST", urlStr, nil, nil, accessToken)
+	if err != nil {
+		return fmt.Errorf("error joining the room: %s", err)
+	}
+	return nil
+}
+
+func doRoomInvite(meta Metadata, roomId string, userId string, accessToken string) error {
+	request := &api.InviteRequest{UserId: userId}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/invite")
+	log.Println("[DEBUG] Inviting", userId, ":", urlStr)
+	err := api.DoRequest("POST", urlStr, request, nil, accessToken)
+	if err != nil {
+		return fmt.Errorf("error inviting %s: %s", userId, err)
+	}
+	return nil
+}
+
+func doRoomKick(meta Metadata, roomId string, userId string, reason string, accessToken string) error {
+	request := &api.KickRequest{UserId: userId, Reason: reason}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/kick")
+	log.Println("[DEBUG] Kicking", userId, ":", urlStr)
+	err := api.DoRequest("POST", urlStr, request, nil, accessToken)
+	if err != nil {
+		return fmt.Errorf("error kicking %s: %s", userId, err)
+	}
+	return nil
+}
+
+func doRoomBan(meta Metadata, roomId string, userId string, reason string, accessToken string) error {
+	// Bans take the same shape of request as kicks
+	request := &api.KickRequest{UserId: userId, Reason: reason}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/ban")
+	log.Println("[DEBUG] Banning", userId, ":", urlStr)
+	err := api.DoRequest("POST", urlStr, request, nil, accessToken)
+	if err != nil {
+		return fmt.Errorf("error banning %s: %s", userId, err)
+	}
+	return nil
+}
+
+func doRoomUnban(meta Metadata, roomId string, userId string, accessToken string) error {
+	request := &api.UnbanRequest{UserId: userId}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/unban")
+	log.Println("[DEBUG] Unbanning", userId, ":", urlStr)
+	err := api.DoRequest("POST", urlStr, request, nil, accessToken)
+	if err != nil {
+		return fmt.Errorf("error unbanning %s: %s", userId, err)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package matrix
+
+import (
+	"testing"
+	"github.com/hashicorp/terraform/helper/resource"
+	"fmt"
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/hashicorp/terraform/helper/schema"
+	"net/http"
+	"net/http/httptest"
+)
+
+var testAccMatrixRoomMemberConfig_invite = `
+resource "matrix_room_member" "foobar" {
+	room_id = "%s"
+	user_id = "%s"
+	membership = "invite"
+}`
+
+func TestAccMatrixRoomMember_Invite(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", false, "private_chat")
+	target := testAccCreateTestUser("test_acc_room_member_invite")
+	conf := fmt.Sprintf(testAccMatrixRoomMemberConfig_invite, room.RoomId, target.UserId)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomMemberDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomMemberMembership("matrix_room_member.foobar", "invite"),
+					resource.TestCheckResourceAttr("matrix_room_member.foobar", "id", makeRoomMemberId(room.RoomId, target.UserId)),
+					resource.TestCheckResourceAttr("matrix_room_member.foobar", "room_id", room.RoomId),
+					resource.TestCheckResourceAttr("matrix_room_member.foobar", "user_id", target.UserId),
+					resource.TestCheckResourceAttr("matrix_room_member.foobar", "membership", "invite"),
+				),
+			},
+		},
+	})
+}
+
+var testAccMatrixRoomMemberConfig_join = `
+resource "matrix_room_member" "foobar" {
+	room_id = "%s"
+	user_id = "%s"
+	membership = "join"
+	member_access_token = "%s"
+}`
+
+func TestAccMatrixRoomMember_Join(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", false, "private_chat")
+	target := testAccCreateTestUser("test_acc_room_member_join")
+	conf := fmt.Sprintf(testAccMatrixRoomMemberConfig_join, room.RoomId, target.UserId, target.AccessToken)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomMemberDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomMemberMembership("matrix_room_member.foobar", "join"),
+					resource.TestCheckResourceAttr("matrix_room_member.foobar", "membership", "join"),
+				),
+			},
+			{
+				ResourceName:            "matrix_room_member.foobar",
+				ImportState:             true,
+				ImportStateId:           makeRoomMemberId(room.RoomId, target.UserId),
+				ImportStateVerify:       true,
+				ImportStateVerifyIgnore: []string{"member_access_token"},
+			},
+		},
+	})
+}
+
+var testAccMatrixRoomMemberConfig_ban = `
+resource "matrix_room_member" "foobar" {
+	room_id = "%s"
+	user_id = "%s"
+	membership = "%s"
+	reason = "Testing"
+}`
+
+func TestAccMatrixRoomMember_InviteThenBan(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", false, "private_chat")
+	target := testAccCreateTestUser("test_acc_room_member_ban")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomMemberDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomMemberConfig_ban, room.RoomId, target.UserId, "invite"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomMemberMembership("matrix_room_member.foobar", "invite"),
+					resource.TestCheckResourceAttr("matrix_room_member.foobar", "membership", "invite"),
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomMemberConfig_ban, room.RoomId, target.UserId, "ban"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomMemberMembership("matrix_room_member.foobar", "ban"),
+					resource.TestCheckResourceAttr("matrix_room_member.foobar", "membership", "ban"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckMatrixRoomMemberDestroy(s *terraform.State) error {
+	meta := testAccProvider.Meta().(Metadata)
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "matrix_room_member" {
+			continue
+		}
+
+		member, err := getRoomMemberEvent(meta, rs.Primary.Attributes["room_id"], rs.Primary.Attributes["user_id"], testAccAdminToken())
+		if err != nil {
+			return err
+		}
+		if member.Content.Membership == "join" || member.Content.Membership == "invite" || member.Content.Membership == "ban" {
+			return fmt.Errorf("membership was not removed, got: %s", member.Content.Membership)
+		}
+	}
+
+	return nil
+}
+
+func testAccCheckMatrixRoomMemberMembership(n string, expected string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		meta := testAccProvider.Meta().(Metadata)
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("not found: %s", n)
+		}
+
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("record id not set")
+		}
+
+		member, err := getRoomMemberEvent(meta, rs.Primary.Attributes["room_id"], rs.Primary.Attributes["user_id"], testAccAdminToken())
+		if err != nil {
+			return err
+		}
+		if member.Content.Membership != expected {
+			return fmt.Errorf("membership mismatch. expected: %s  got: %s", expected, member.Content.Membership)
+		}
+
+		return nil
+	}
+}
+
+func TestUnitRoomMemberRead_roomGone(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusNotFound} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(`{"errcode":"M_FORBIDDEN","error":"You aren't a member of the room"}`))
+		}))
+
+		d := schema.TestResourceDataRaw(t, resourceRoomMember().Schema, map[string]interface{}{
+			"room_id":    "!room:localhost",
+			"user_id":    "@alice:localhost",
+			"membership": "join",
+		})
+		d.SetId(makeRoomMemberId("!room:localhost", "@alice:localhost"))
+
+		err := resourceRoomMemberRead(d, Metadata{ClientApiUrl: server.URL, DefaultAccessToken: "admin_token"})
+		server.Close()
+		if err != nil {
+			t.Errorf("unexpected error for status %d: %s", status, err)
+		}
+		if d.Id() != "" {
+			t.Errorf("expected the ID to be cleared for status %d, got: %s", status, d.Id())
+		}
+	}
+}
+
+func TestUnitRoomMemberRead_neverInRoom(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_matrix/client/r0/rooms/!room:localhost/state/m.room.create" {
+			w.Write([]byte(`{"creator":"@bob:localhost"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errcode":"M_NOT_FOUND","error":"Event not found"}`))
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceRoomMember().Schema, map[string]interface{}{
+		"room_id":    "!room:localhost",
+		"user_id":    "@alice:localhost",
+		"membership": "join",
+	})
+	d.SetId(makeRoomMemberId("!room:localhost", "@alice:localhost"))
+
+	err := resourceRoomMemberRead(d, Metadata{ClientApiUrl: server.URL, DefaultAccessToken: "admin_token"})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if d.Id() == "" {
+		t.Errorf("expected the ID to be kept")
+	}
+	if d.Get("membership").(string) != "leave" {
+		t.Errorf("expected membership to be leave, got: %s", d.Get("membership"))
+	}
+}
+
+func TestUnitRoomMemberImport(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourceRoomMember().Schema, map[string]interface{}{})
+	d.SetId("!room:localhost/@alice:localhost")
+
+	_, err := resourceRoomMemberImport(d, Metadata{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if d.Get("room_id").(string) != "!room:localhost" {
+		t.Errorf("unexpected room_id: %s", d.Get("room_id"))
+	}
+	if d.Get("user_id").(string) != "@alice:localhost" {
+		t.Errorf("unexpected user_id: %s", d.Get("user_id"))
+	}
+
+	for _, id := range []string{"!room:localhost", "@alice:localhost/!room:localhost", "!room:localhost/"} {
+		d.SetId(id)
+		_, err = resourceRoomMemberImport(d, Metadata{})
+		if err == nil {
+			t.Errorf("expected an error importing %s", id)
+		}
+	}
+}
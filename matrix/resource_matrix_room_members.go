@@ -0,0 +1,211 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+)
+
+func resourceRoomMembers() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceRoomMembersCreate,
+		Read:   resourceRoomMembersRead,
+		Update: resourceRoomMembersUpdate,
+		Delete: resourceRoomMembersDelete,
+
+		Schema: map[string]*schema.Schema{
+			"room_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"user_ids": {
+				Type: schema.TypeSet,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Required: true,
+			},
+			"exclude_user_ids": {
+				Type: schema.TypeSet,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
+				// Glob patterns are supported, eg: @*bot:domain.com
+			},
+			"removal_action": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "kick",
+				ValidateFunc: validation.StringInSlice([]string{"kick", "ban"}, false),
+			},
+			"reason": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"admin_access_token": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// Defaults to the provider's default access token
+			},
+		},
+	}
+}
+
+func resourceRoomMembersCreate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	err := resourceRoomMembersApply(d, meta)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(d.Get("room_id").(string))
+	return resourceRoomMembersRead(d, meta)
+}
+
+func resourceRoomMembersRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	roomId := d.Get("room_id").(string)
+	adminToken := resourceRoomMemberAdminToken(d, meta)
+
+	exclusions, err := resourceRoomMembersExclusions(d, meta)
+	if err != nil {
+		return err
+	}
+
+	members, err := getRoomMembers(meta, roomId, adminToken)
+	if err != nil {
+		return err
+	}
+
+	declared := d.Get("user_ids").(*schema.Set)
+	userIds := make([]string, 0)
+	for _, member := range members {
+		if member.Content == nil {
+			return fmt.Errorf("member %s has no content in their member event", member.StateKey)
+		}
+		if matchesAnyPattern(member.StateKey, exclusions) && !declared.Contains(member.StateKey) {
+			// Excluded users only show up if they were declared, so they don't cause a diff either way
+			continue
+		}
+		if member.Content.Membership == "invite" || member.Content.Membership == "join" {
+			userIds = append(userIds, member.StateKey)
+		}
+	}
+
+	d.Set("user_ids", userIds)
+	return nil
+}
+
+func resourceRoomMembersUpdate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	if d.HasChange("user_ids") || d.HasChange("exclude_user_ids") {
+		err := resourceRoomMembersApply(d, meta)
+		if err != nil {
+			return err
+		}
+	}
+
+	return resourceRoomMembersRead(d, meta)
+}
+
+func resourceRoomMembersDelete(d *schema.ResourceData, m interface{}) error {
+	// Removing everyone from the room would be surprising, so we just stop managing the membership
+	return nil
+}
+
+func resourceRoomMembersApply(d *schema.ResourceData, meta Metadata) error {
+	roomId := d.Get("room_id").(string)
+	desired := setOfStrings(d.Get("user_ids").(*schema.Set))
+	removalAction := d.Get("removal_action").(string)
+	reason := d.Get("reason").(string)
+	adminToken := resourceRoomMemberAdminToken(d, meta)
+
+	exclusions, err := resourceRoomMembersExclusions(d, meta)
+	if err != nil {
+		return err
+	}
+
+	members, err := getRoomMembers(meta, roomId, adminToken)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string]string)
+	for _, member := range members {
+		if member.Content == nil {
+			return fmt.Errorf("member %s has no content in their member event", member.StateKey)
+		}
+		current[member.StateKey] = member.Content.Membership
+	}
+
+	wanted := make(map[string]bool)
+	for _, userId := range desired {
+		wanted[userId] = true
+		if matchesAnyPattern(userId, exclusions) {
+			continue
+		}
+
+		membership := current[userId]
+		if membership == "join" || membership == "invite" {
+			continue
+		}
+		if membership == "ban" {
+			err = doRoomUnban(meta, roomId, userId, adminToken)
+			if err != nil {
+				return err
+			}
+		}
+
+		log.Println("[DEBUG] Adding missing member:", userId)
+		err = doRoomInvite(meta, roomId, userId, adminToken)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reason == "" {
+		reason = "Not a member of this room in Terraform"
+	}
+	for userId, membership := range current {
+		if wanted[userId] || matchesAnyPattern(userId, exclusions) {
+			continue
+		}
+		if membership != "join" && membership != "invite" {
+			continue
+		}
+
+		log.Println("[DEBUG] Removing extra member:", userId)
+		if removalAction == "ban" {
+			err = doRoomBan(meta, roomId, userId, reason, adminToken)
+		} else {
+			err = doRoomKick(meta, roomId, userId, reason, adminToken)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func resourceRoomMembersExclusions(d *schema.ResourceData, meta Metadata) ([]string, error) {
+	exclusions := setOfStrings(d.Get("exclude_user_ids").(*schema.Set))
+
+	// The managing account is always left alone, otherwise it would remove itself from the room
+	log.Println("[DEBUG] Performing whoami on admin access token")
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/account/whoami")
+	whoAmIResponse := &api.WhoAmIResponse{}
+	err := api.DoRequest("GET", urlStr, nil, whoAmIResponse, resourceRoomMemberAdminToken(d, meta))
+	if err != nil {
+		return nil, fmt.Errorf("error performing whoami: %s", err)
+	}
+
+	return append(exclusions, whoAmIResponse.UserId), nil
+}
@@ -0,0 +1,77 @@
+package matrix
+
+import (
+	"testing"
+	"github.com/hashicorp/terraform/helper/resource"
+	"fmt"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+var testAccMatrixRoomMembersConfig_members = `
+resource "matrix_room_members" "foobar" {
+	room_id = "%s"
+	user_ids = ["%s"]
+	exclude_user_ids = ["%s"]
+}`
+
+func TestAccMatrixRoomMembers_RemovesExtraMembers(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", false, "private_chat")
+	targetA := testAccCreateTestUser("test_acc_room_members_user_a")
+	targetB := testAccCreateTestUser("test_acc_room_members_user_b")
+	excluded := testAccCreateTestUser("test_acc_room_members_bot")
+
+	// Invite someone who isn't listed, and someone who is excluded
+	meta := Metadata{ClientApiUrl: testAccClientServerUrl()}
+	for _, userId := range []string{targetB.UserId, excluded.UserId} {
+		err := doRoomInvite(meta, room.RoomId, userId, testAccAdminToken())
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	conf := fmt.Sprintf(testAccMatrixRoomMembersConfig_members, room.RoomId, targetA.UserId, excluded.UserId)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		// Memberships are left alone when the resource is destroyed
+		//CheckDestroy: testAccCheckMatrixRoomMembersDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomMembersMembership("matrix_room_members.foobar", targetA.UserId, "invite"),
+					testAccCheckMatrixRoomMembersMembership("matrix_room_members.foobar", targetB.UserId, "leave"),
+					testAccCheckMatrixRoomMembersMembership("matrix_room_members.foobar", excluded.UserId, "invite"),
+					resource.TestCheckResourceAttr("matrix_room_members.foobar", "id", room.RoomId),
+					resource.TestCheckResourceAttr("matrix_room_members.foobar", "user_ids.#", "1"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckMatrixRoomMembersMembership(n string, userId string, expected string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		meta := testAccProvider.Meta().(Metadata)
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("not found: %s", n)
+		}
+
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("record id not set")
+		}
+
+		member, err := getRoomMemberEvent(meta, rs.Primary.ID, userId, testAccAdminToken())
+		if err != nil {
+			return err
+		}
+		if member.Content.Membership != expected {
+			return fmt.Errorf("membership mismatch for %s. expected: %s  got: %s", userId, expected, member.Content.Membership)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/structure"
+	"github.com/hashicorp/terraform/helper/validation"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"net/http"
+	"net/url"
+)
+
+func resourceRoomStateEvent() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceRoomStateEventCreate,
+		Read:   resourceRoomStateEventRead,
+		Update: resourceRoomStateEventUpdate,
+		Delete: resourceRoomStateEventDelete,
+
+		Schema: map[string]*schema.Schema{
+			"room_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"member_access_token": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"event_type": {
+				Type:         schema.TypeString,
+				Required:     true,
+				ForceNew:     true,
+				ValidateFunc: validation.NoZeroValues,
+			},
+			"state_key": {
+				Type:     schema.TypeString,
+				Optional: true,
+				Default:  "",
+				ForceNew: true,
+			},
+			"content_json": {
+				Type:             schema.TypeString,
+				Required:         true,
+				ValidateFunc:     validation.ValidateJsonString,
+				DiffSuppressFunc: structure.SuppressJsonDiff,
+			},
+			"destroy_content_json": {
+				Type:             schema.TypeString,
+				Optional:         true,
+				Default:          "{}",
+				ValidateFunc:     validation.ValidateJsonString,
+				DiffSuppressFunc: structure.SuppressJsonDiff,
+			},
+		},
+	}
+}
+
+func resourceRoomStateEventCreate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	roomId := d.Get("room_id").(string)
+	eventType := d.Get("event_type").(string)
+	stateKey := d.Get("state_key").(string)
+
+	err := resourceRoomStateEventSend(d, meta, d.Get("content_json").(string))
+	if err != nil {
+		return err
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s/%s", roomId, eventType, stateKey))
+	return resourceRoomStateEventRead(d, meta)
+}
+
+func resourceRoomStateEventRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	memberAccessToken := d.Get("member_access_token").(string)
+	roomId := d.Get("room_id").(string)
+	eventType := d.Get("event_type").(string)
+	stateKey := d.Get("state_key").(string)
+
+	content := make(map[string]interface{})
+	urlStr := makeStateEventUrl(meta.ClientApiUrl, roomId, eventType, stateKey)
+	log.Println("[DEBUG] Getting state event:", urlStr)
+	err := api.DoRequest("GET", urlStr, nil, &content, memberAccessToken)
+	if err != nil {
+		if r, ok := err.(*api.ErrorResponse); ok && r.StatusCode == http.StatusNotFound {
+			log.Println("[DEBUG] State event not found, considering it deleted")
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("error getting state event: %s", err)
+	}
+
+	contentJson, err := structure.FlattenJsonToString(content)
+	if err != nil {
+		return fmt.Errorf("error serializing state event content: %s", err)
+	}
+
+	d.Set("content_json", contentJson)
+	return nil
+}
+
+func resourceRoomStateEventUpdate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	if d.HasChange("content_json") {
+		err := resourceRoomStateEventSend(d, meta, d.Get("content_json").(string))
+		if err != nil {
+			return err
+		}
+	}
+
+	return resourceRoomStateEventRead(d, meta)
+}
+
+func resourceRoomStateEventDelete(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	// State events cannot be removed from a room, so we replace the content instead
+	return resourceRoomStateEventSend(d, meta, d.Get("destroy_content_json").(string))
+}
+
+func resourceRoomStateEventSend(d *schema.ResourceData, meta Metadata, contentJson string) error {
+	memberAccessToken := d.Get("member_access_token").(string)
+	roomId := d.Get("room_id").(string)
+	eventType := d.Get("event_type").(string)
+	stateKey := d.Get("state_key").(string)
+
+	content, err := structure.ExpandJsonFromString(contentJson)
+	if err != nil {
+		return fmt.Errorf("error parsing state event content: %s", err)
+	}
+
+	response := &api.EventIdResponse{}
+	urlStr := makeStateEventUrl(meta.ClientApiUrl, roomId, eventType, stateKey)
+	log.Println("[DEBUG] Sending state event:", urlStr)
+	err = api.DoRequest("PUT", urlStr, content, response, memberAccessToken)
+	if err != nil {
+		return fmt.Errorf("error sending state event: %s", err)
+	}
+
+	return nil
+}
+
+func makeStateEventUrl(csApiUrl string, roomId string, eventType string, stateKey string) string {
+	urlStr := api.MakeUrl(csApiUrl, "/_matrix/client/r0/rooms/", roomId, "/state/", url.PathEscape(eventType))
+	if stateKey != "" {
+		urlStr = api.MakeUrl(urlStr, url.PathEscape(stateKey))
+	}
+	return urlStr
+}
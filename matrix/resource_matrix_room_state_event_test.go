@@ -0,0 +1,128 @@
+package matrix
+
+import (
+	"testing"
+	"github.com/hashicorp/terraform/helper/resource"
+	"fmt"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"github.com/hashicorp/terraform/terraform"
+	"encoding/json"
+)
+
+func TestUnitMakeStateEventUrl_withoutStateKey(t *testing.T) {
+	result := makeStateEventUrl("https://domain.com", "!room:domain.com", "m.room.name", "")
+	expected := "https://domain.com/_matrix/client/r0/rooms/!room:domain.com/state/m.room.name"
+	if result != expected {
+		t.Errorf("expected: %s  got: %s", expected, result)
+	}
+}
+
+func TestUnitMakeStateEventUrl_withStateKey(t *testing.T) {
+	result := makeStateEventUrl("https://domain.com", "!room:domain.com", "im.vector.modular.widgets", "some/widget")
+	expected := "https://domain.com/_matrix/client/r0/rooms/!room:domain.com/state/im.vector.modular.widgets/some%2Fwidget"
+	if result != expected {
+		t.Errorf("expected: %s  got: %s", expected, result)
+	}
+}
+
+var testAccMatrixRoomStateEventConfig_custom = `
+resource "matrix_room_state_event" "foobar" {
+	room_id = "%s"
+	member_access_token = "%s"
+	event_type = "com.example.test"
+	state_key = "%s"
+	content_json = <<EOT
+%s
+EOT
+}`
+
+func TestAccMatrixRoomStateEvent_CustomEvent(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", false, "private_chat")
+	stateKey := "test_key"
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomStateEventDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomStateEventConfig_custom, room.RoomId, room.CreatorToken, stateKey, `{"hello": "world", "a": 1}`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomStateEventContent("matrix_room_state_event.foobar", map[string]interface{}{"hello": "world", "a": float64(1)}),
+					resource.TestCheckResourceAttr("matrix_room_state_event.foobar", "id", fmt.Sprintf("%s/com.example.test/%s", room.RoomId, stateKey)),
+					resource.TestCheckResourceAttr("matrix_room_state_event.foobar", "state_key", stateKey),
+				),
+			},
+			{
+				// Reordering the keys should not produce a diff
+				Config:   fmt.Sprintf(testAccMatrixRoomStateEventConfig_custom, room.RoomId, room.CreatorToken, stateKey, `{"a": 1, "hello": "world"}`),
+				PlanOnly: true,
+			},
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomStateEventConfig_custom, room.RoomId, room.CreatorToken, stateKey, `{"hello": "there"}`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomStateEventContent("matrix_room_state_event.foobar", map[string]interface{}{"hello": "there"}),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckMatrixRoomStateEventDestroy(s *terraform.State) error {
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "matrix_room_state_event" {
+			continue
+		}
+
+		content, err := testAccGetMatrixRoomStateEventContent(rs)
+		if err != nil {
+			return err
+		}
+		if len(content) != 0 {
+			return fmt.Errorf("state event content was not blanked")
+		}
+	}
+
+	return nil
+}
+
+func testAccCheckMatrixRoomStateEventContent(n string, expected map[string]interface{}) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("not found: %s", n)
+		}
+
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("record id not set")
+		}
+
+		content, err := testAccGetMatrixRoomStateEventContent(rs)
+		if err != nil {
+			return err
+		}
+
+		expectedJson, _ := json.Marshal(expected)
+		contentJson, _ := json.Marshal(content)
+		if string(expectedJson) != string(contentJson) {
+			return fmt.Errorf("content mismatch. expected: %s  got: %s", expectedJson, contentJson)
+		}
+
+		return nil
+	}
+}
+
+func testAccGetMatrixRoomStateEventContent(rs *terraform.ResourceState) (map[string]interface{}, error) {
+	meta := testAccProvider.Meta().(Metadata)
+	attrs := rs.Primary.Attributes
+
+	content := make(map[string]interface{})
+	urlStr := makeStateEventUrl(meta.ClientApiUrl, attrs["room_id"], attrs["event_type"], attrs["state_key"])
+	err := api.DoRequest("GET", urlStr, nil, &content, attrs["member_access_token"])
+	if err != nil {
+		return nil, fmt.Errorf("error getting state event: %s", err)
+	}
+
+	return content, nil
+}
@@ -10,6 +10,13 @@ import (
 	"regexp"
 	"net/http"
 	"net/url"
+	"net/http/httptest"
+	"github.com/hashicorp/terraform/helper/schema"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"github.com/hashicorp/terraform/config"
 )
 
 type testAccMatrixRoom struct {
@@ -23,6 +30,19 @@ type testAccMatrixRoom struct {
 	Preset        string
 }
 
+type testAccCreateRoomAliasRequest struct {
+	RoomId string `json:"room_id"`
+}
+
+func testAccCreateRoomAlias(roomId string, alias string, accessToken string) {
+	request := &testAccCreateRoomAliasRequest{RoomId: roomId}
+	urlStr := api.MakeUrl(testAccClientServerUrl(), "/_matrix/client/r0/directory/room/", url.QueryEscape(alias))
+	err := api.DoRequest("PUT", urlStr, request, nil, accessToken)
+	if err != nil {
+		panic(err)
+	}
+}
+
 func testAccCreateMatrixRoom(name string, avatarMxc string, topic string, guestsAllowed bool, preset string) (*testAccMatrixRoom) {
 	guestAccess := api.RoomGuestAccessEventContent{Policy: "forbidden"}
 	if guestsAllowed {
@@ -203,6 +223,56 @@ resource "matrix_room" "foobar" {
 	local_alias_localpart = "%s"
 }`
 
+func TestAccMatrixRoom_UpdateInvites(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_room_update_invites")
+	targetA := testAccCreateTestUser("test_acc_room_update_invites_user_a")
+	targetB := testAccCreateTestUser("test_acc_room_update_invites_user_b")
+	targetC := testAccCreateTestUser("test_acc_room_update_invites_user_c")
+	var originalRoomId string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomConfig_invites, creator.UserId, creator.AccessToken, targetA.UserId, targetB.UserId),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomInvitedUsers("matrix_room.foobar", []string{targetA.UserId, targetB.UserId}),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "invite_user_ids.#", "2"),
+					func(s *terraform.State) error {
+						originalRoomId = s.RootModule().Resources["matrix_room.foobar"].Primary.ID
+						return nil
+					},
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomConfig_invites, creator.UserId, creator.AccessToken, targetA.UserId, targetC.UserId),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomInvitedUsers("matrix_room.foobar", []string{targetA.UserId, targetC.UserId}),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "invite_user_ids.#", "2"),
+					func(s *terraform.State) error {
+						meta := testAccProvider.Meta().(Metadata)
+						rs := s.RootModule().Resources["matrix_room.foobar"]
+						if rs.Primary.ID != originalRoomId {
+							return fmt.Errorf("room was replaced. expected: %s  got: %s", originalRoomId, rs.Primary.ID)
+						}
+
+						member, err := getRoomMemberEvent(meta, rs.Primary.ID, targetB.UserId, creator.AccessToken)
+						if err != nil {
+							return err
+						}
+						if member.Content.Membership != "leave" {
+							return fmt.Errorf("invite was not rescinded, got membership: %s", member.Content.Membership)
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
 func TestAccMatrixRoom_LocalAlias(t *testing.T) {
 	creator := testAccCreateTestUser("test_acc_room_local_alias")
 	room := &testAccMatrixRoom{
@@ -238,6 +308,484 @@ func TestAccMatrixRoom_LocalAlias(t *testing.T) {
 	})
 }
 
+var testAccMatrixRoomConfig_roomVersion = `
+resource "matrix_room" "foobar" {
+	creator_user_id = "%s"
+	member_access_token = "%s"
+	name = "Sample"
+	room_version = "%s"
+}`
+
+func TestAccMatrixRoom_RoomVersionUpgrade(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_room_version_upgrade")
+	var originalRoomId string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomConfig_roomVersion, creator.UserId, creator.AccessToken, "4"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomExists("matrix_room.foobar"),
+					testAccCheckMatrixRoomIdMatchesRoomId("matrix_room.foobar"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "room_version", "4"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "predecessor_room_id", ""),
+					func(s *terraform.State) error {
+						originalRoomId = s.RootModule().Resources["matrix_room.foobar"].Primary.ID
+						return nil
+					},
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomConfig_roomVersion, creator.UserId, creator.AccessToken, "5"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomExists("matrix_room.foobar"),
+					testAccCheckMatrixRoomIdMatchesRoomId("matrix_room.foobar"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "room_version", "5"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "name", "Sample"),
+					func(s *terraform.State) error {
+						rs := s.RootModule().Resources["matrix_room.foobar"]
+						if rs.Primary.ID == originalRoomId {
+							return fmt.Errorf("room id did not change after upgrade")
+						}
+						if rs.Primary.Attributes["predecessor_room_id"] != originalRoomId {
+							return fmt.Errorf("predecessor mismatch. expected: %s  got: %s", originalRoomId, rs.Primary.Attributes["predecessor_room_id"])
+						}
+						if rs.Primary.Attributes["previous_room_ids.0"] != originalRoomId {
+							return fmt.Errorf("previous room mismatch. expected: %s  got: %s", originalRoomId, rs.Primary.Attributes["previous_room_ids.0"])
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+var testAccMatrixRoomConfig_unsupportedRoomVersion = `
+resource "matrix_room" "foobar" {
+	creator_user_id = "%s"
+	member_access_token = "%s"
+	room_version = "not-a-real-version"
+}`
+
+func TestAccMatrixRoom_UnsupportedRoomVersion(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_room_version_unsupported")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testAccMatrixRoomConfig_unsupportedRoomVersion, creator.UserId, creator.AccessToken),
+				ExpectError: regexp.MustCompile("room version not-a-real-version is not supported by the server"),
+			},
+		},
+	})
+}
+
+var testAccMatrixRoomConfig_serverAcl = `
+resource "matrix_room" "foobar" {
+	creator_user_id = "%s"
+	member_access_token = "%s"
+	server_acl {
+		allow = ["*"]
+		deny = [%s]
+		allow_ip_literals = false
+	}
+}`
+
+func TestAccMatrixRoom_ServerAcl(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_room_server_acl")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomConfig_serverAcl, creator.UserId, creator.AccessToken, `"Evil.Example.COM "`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomExists("matrix_room.foobar"),
+					testAccCheckMatrixRoomServerAclDenies("matrix_room.foobar", []string{"evil.example.com"}),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "server_acl.#", "1"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "server_acl.0.allow_ip_literals", "false"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "server_acl.0.deny.#", "1"),
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomConfig_serverAcl, creator.UserId, creator.AccessToken, `"evil.example.com", "*.spam.example.com"`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomServerAclDenies("matrix_room.foobar", []string{"evil.example.com", "*.spam.example.com"}),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "server_acl.0.deny.#", "2"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccMatrixRoom_ServerAclLockout(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_room_server_acl_lockout")
+	hsDomain, err := getDomainName(creator.UserId)
+	if err != nil {
+		panic(err)
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config:      fmt.Sprintf(testAccMatrixRoomConfig_serverAcl, creator.UserId, creator.AccessToken, fmt.Sprintf(`"%s"`, getServerNameHost(hsDomain))),
+				ExpectError: regexp.MustCompile("server_acl would lock .+ out of the room"),
+			},
+		},
+	})
+}
+
+func TestAccMatrixRoom_ImportByRoomId(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", true, "private_chat")
+	conf := fmt.Sprintf(testAccMatrixRoomConfig_existingRoom, room.RoomId, room.CreatorToken)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+			},
+			{
+				ResourceName:      "matrix_room.foobar",
+				ImportState:       true,
+				ImportStateId:     room.RoomId,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestAccMatrixRoom_ImportByAlias(t *testing.T) {
+	room := testAccCreateMatrixRoom("Sample", "mxc://localhost/AvatarHere", "This is a topic", true, "private_chat")
+	conf := fmt.Sprintf(testAccMatrixRoomConfig_existingRoom, room.RoomId, room.CreatorToken)
+
+	hsDomain, err := getDomainName(room.CreatorUserId)
+	if err != nil {
+		panic(err)
+	}
+	alias := fmt.Sprintf("#test_acc_room_import_alias:%s", hsDomain)
+	testAccCreateRoomAlias(room.RoomId, alias, room.CreatorToken)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+			},
+			{
+				ResourceName:      "matrix_room.foobar",
+				ImportState:       true,
+				ImportStateId:     alias,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+var testAccMatrixRoomConfig_importCreated = `
+resource "matrix_room" "foobar" {
+	creator_user_id = "%s"
+	member_access_token = "%s"
+	preset = "public_chat"
+	local_alias_localpart = "%s"
+	invite_user_ids = ["%s"]
+}`
+
+func TestAccMatrixRoom_ImportCreatedRoom(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_room_import_created")
+	target := testAccCreateTestUser("test_acc_room_import_created_target")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccMatrixRoomConfig_importCreated, creator.UserId, creator.AccessToken, "test_acc_room_import_created", target.UserId),
+			},
+			{
+				ResourceName:      "matrix_room.foobar",
+				ImportState:       true,
+				ImportStateVerify: true,
+				// Imported rooms are managed with the provider's default access token
+				ImportStateVerifyIgnore: []string{"member_access_token"},
+			},
+		},
+	})
+}
+
+var testAccMatrixRoomConfig_creationContent = `
+resource "matrix_room" "foobar" {
+	creator_user_id = "%s"
+	member_access_token = "%s"
+	name = "Sample"
+	creation_content_json = "{\"m.federate\":false}"
+
+	initial_state {
+		type = "com.example.settings"
+		state_key = "sample"
+		content_json = "{\"enabled\":true}"
+	}
+}`
+
+func TestAccMatrixRoom_CreationContentAndInitialState(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_room_creation_content")
+	conf := fmt.Sprintf(testAccMatrixRoomConfig_creationContent, creator.UserId, creator.AccessToken)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixRoomDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomExists("matrix_room.foobar"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "creation_content_json", "{\"m.federate\":false}"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "initial_state.#", "1"),
+					testAccCheckMatrixRoomStateContent("matrix_room.foobar", "com.example.settings", "sample", map[string]interface{}{"enabled": true}),
+				),
+			},
+		},
+	})
+}
+
+func TestUnitSuppressCreationContentDiff(t *testing.T) {
+	cases := []struct {
+		old      string
+		new      string
+		suppress bool
+	}{
+		{`{"m.federate":false}`, `{"m.federate": false}`, true},
+		{`{"m.federate":false,"type":"m.space"}`, `{"m.federate":false}`, true},
+		{`{"m.federate":false,"type":"m.space"}`, `{"m.federate":false,"type":"m.space"}`, true},
+		{`{"type":"m.space"}`, `{"type":"com.example.room"}`, false},
+		{`{}`, `{"m.federate":false}`, false},
+		{``, `{"m.federate":false}`, false},
+	}
+
+	for _, c := range cases {
+		if suppressCreationContentDiff("creation_content_json", c.old, c.new, nil) != c.suppress {
+			t.Errorf("unexpected result for %s -> %s. expected suppression: %t", c.old, c.new, c.suppress)
+		}
+	}
+}
+
+func TestUnitRoomPurge_pollsUntilComplete(t *testing.T) {
+	statusRequests := 0
+	var deleteRequest api.AdminDeleteRoomRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer admin_token" {
+			t.Errorf("unexpected authorization header: %s", r.Header.Get("Authorization"))
+		}
+
+		switch {
+		case r.Method == "DELETE" && r.URL.Path == "/_synapse/admin/v2/rooms/!room:localhost":
+			json.NewDecoder(r.Body).Decode(&deleteRequest)
+			w.Write([]byte(`{"delete_id":"abc123"}`))
+		case r.Method == "GET" && r.URL.Path == "/_synapse/admin/v2/rooms/delete_status/abc123":
+			statusRequests++
+			if statusRequests < 2 {
+				w.Write([]byte(`{"status":"purging"}`))
+			} else {
+				w.Write([]byte(`{"status":"complete"}`))
+			}
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceRoom().Schema, map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+		"destroy_strategy":    "purge",
+		"purge_options": []interface{}{
+			map[string]interface{}{
+				"block":         true,
+				"purge_history": true,
+				"message":       "Gone",
+			},
+		},
+	})
+	d.SetId("!room:localhost")
+
+	err := resourceRoomDelete(d, Metadata{ClientApiUrl: server.URL, AdminAccessToken: "admin_token"})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if statusRequests != 2 {
+		t.Errorf("unexpected number of status requests. expected: %d  got: %d", 2, statusRequests)
+	}
+	if !deleteRequest.Block || !deleteRequest.Purge || deleteRequest.Message != "Gone" {
+		t.Errorf("unexpected delete request: %#v", deleteRequest)
+	}
+}
+
+func TestUnitRoomPurge_failedDelete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "DELETE" {
+			w.Write([]byte(`{"delete_id":"abc123"}`))
+		} else {
+			w.Write([]byte(`{"status":"failed","error":"something broke"}`))
+		}
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceRoom().Schema, map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+		"destroy_strategy":    "purge",
+	})
+	d.SetId("!room:localhost")
+
+	err := resourceRoomDelete(d, Metadata{ClientApiUrl: server.URL, AdminAccessToken: "admin_token"})
+	if err == nil || !strings.Contains(err.Error(), "something broke") {
+		t.Errorf("expected a failure, got: %v", err)
+	}
+}
+
+func TestUnitRoomPurge_fallsBackToV1(t *testing.T) {
+	var deleteRequest api.AdminDeleteRoomRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "DELETE" && r.URL.Path == "/_synapse/admin/v2/rooms/!room:localhost":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errcode":"M_UNRECOGNIZED","error":"Unrecognized request"}`))
+		case r.Method == "POST" && r.URL.Path == "/_synapse/admin/v1/rooms/!room:localhost/delete":
+			if !strings.Contains(r.RequestURI, "%21room:localhost") {
+				t.Errorf("expected the room ID to be escaped, got: %s", r.RequestURI)
+			}
+			json.NewDecoder(r.Body).Decode(&deleteRequest)
+			w.Write([]byte(`{"kicked_users":[],"failed_to_kick_users":[],"local_aliases":[],"new_room_id":null}`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceRoom().Schema, map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+		"destroy_strategy":    "purge",
+		"purge_options": []interface{}{
+			map[string]interface{}{
+				"block":         true,
+				"purge_history": true,
+				"message":       "Gone",
+			},
+		},
+	})
+	d.SetId("!room:localhost")
+
+	err := resourceRoomDelete(d, Metadata{ClientApiUrl: server.URL, AdminAccessToken: "admin_token"})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if !deleteRequest.Block || !deleteRequest.Purge || deleteRequest.Message != "Gone" {
+		t.Errorf("unexpected delete request: %#v", deleteRequest)
+	}
+}
+
+var testAccMatrixRoomConfig_destroyStrategy = `
+resource "matrix_room" "foobar" {
+	creator_user_id = "%s"
+	member_access_token = "%s"
+	invite_user_ids = ["%s"]
+	destroy_strategy = "%s"
+}`
+
+func TestAccMatrixRoom_DestroyStrategyBanAll(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_room_destroy_ban_all")
+	target := testAccCreateTestUser("test_acc_room_destroy_ban_all_target")
+	conf := fmt.Sprintf(testAccMatrixRoomConfig_destroyStrategy, creator.UserId, creator.AccessToken, target.UserId, "ban_all")
+	var roomId string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testAccCheckMatrixRoomDestroy,
+			func(s *terraform.State) error {
+				// The creator left, so ask the target about their membership through the room they were banned from
+				meta := testAccProvider.Meta().(Metadata)
+				urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/join")
+				err := api.DoRequest("POST", urlStr, nil, nil, target.AccessToken)
+				if err == nil {
+					return fmt.Errorf("banned user was able to join the room")
+				}
+				return nil
+			},
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomExists("matrix_room.foobar"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "destroy_strategy", "ban_all"),
+					func(s *terraform.State) error {
+						roomId = s.RootModule().Resources["matrix_room.foobar"].Primary.ID
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccMatrixRoom_DestroyStrategyLeaveOnly(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_room_destroy_leave_only")
+	target := testAccCreateTestUser("test_acc_room_destroy_leave_only_target")
+	conf := fmt.Sprintf(testAccMatrixRoomConfig_destroyStrategy, creator.UserId, creator.AccessToken, target.UserId, "leave_only")
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		CheckDestroy: func(s *terraform.State) error {
+			// The invited user should still be able to get in
+			meta := testAccProvider.Meta().(Metadata)
+			for _, rs := range s.RootModule().Resources {
+				if rs.Type != "matrix_room" {
+					continue
+				}
+
+				urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", rs.Primary.ID, "/join")
+				err := api.DoRequest("POST", urlStr, nil, nil, target.AccessToken)
+				if err != nil {
+					return fmt.Errorf("error joining room after leaving it: %s", err)
+				}
+			}
+			return nil
+		},
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixRoomExists("matrix_room.foobar"),
+					resource.TestCheckResourceAttr("matrix_room.foobar", "destroy_strategy", "leave_only"),
+				),
+			},
+		},
+	})
+}
+
 func testAccCheckMatrixRoomDestroy(s *terraform.State) error {
 	meta := testAccProvider.Meta().(Metadata)
 	for _, rs := range s.RootModule().Resources {
@@ -488,3 +1036,584 @@ func testAccCheckMatrixRoomLocalAliasMatches(n string, aliasLocalpart string, cr
 		return nil
 	}
 }
+
+func testAccCheckMatrixRoomServerAclDenies(n string, deny []string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		meta := testAccProvider.Meta().(Metadata)
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("not found: %s", n)
+		}
+
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("record id not set")
+		}
+
+		response := &api.RoomServerAclEventContent{}
+		urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", rs.Primary.ID, "/state/m.room.server_acl")
+		err := api.DoRequest("GET", urlStr, nil, response, rs.Primary.Attributes["member_access_token"])
+		if err != nil {
+			return fmt.Errorf("error getting room server ACL: %s", err)
+		}
+
+		if len(response.Deny) != len(deny) {
+			return fmt.Errorf("deny length mismatch. expected: %d  got: %d", len(deny), len(response.Deny))
+		}
+		for _, expected := range deny {
+			found := false
+			for _, actual := range response.Deny {
+				if actual == expected {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s is not denied", expected)
+			}
+		}
+
+		return nil
+	}
+}
+
+func testUnitRoomStateServer(t *testing.T, requests map[string]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path]++
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/_matrix/client/r0/rooms/!room:localhost/state":
+			w.Write([]byte(`[
+				{"type":"m.room.create","state_key":"","content":{"creator":"@alice:localhost","room_version":"5"}},
+				{"type":"m.room.member","state_key":"@alice:localhost","content":{"membership":"join"}},
+				{"type":"m.room.member","state_key":"@bob:remote.example.org","content":{"membership":"join"}},
+				{"type":"m.room.member","state_key":"@carol:localhost","content":{"membership":"leave"}},
+				{"type":"m.room.member","state_key":"@dave:localhost","content":{"membership":"invite"}},
+				{"type":"m.room.name","state_key":"","content":{"name":"Sample"}},
+				{"type":"m.room.topic","state_key":"","content":{"topic":"This is a topic"}},
+				{"type":"m.room.avatar","state_key":"","content":{"url":"mxc://localhost/AvatarHere"}},
+				{"type":"m.room.guest_access","state_key":"","content":{"guest_access":"can_join"}},
+				{"type":"m.room.join_rules","state_key":"","content":{"join_rule":"public"}},
+				{"type":"m.room.history_visibility","state_key":"","content":{"history_visibility":"world_readable"}},
+				{"type":"m.room.server_acl","state_key":"","content":{"allow":["*"],"deny":["evil.example.org"],"allow_ip_literals":false}}
+			]`))
+		case r.Method == "GET" && r.URL.Path == "/_matrix/client/r0/joined_rooms":
+			w.Write([]byte(`{"joined_rooms":["!other:localhost","!room:localhost"]}`))
+		case r.Method == "POST" && r.URL.Path == "/_matrix/client/r0/rooms/!room:localhost/invite":
+			request := &api.InviteRequest{}
+			json.NewDecoder(r.Body).Decode(request)
+			if request.UserId != "@erin:localhost" {
+				t.Errorf("unexpected invite: %s", request.UserId)
+			}
+			w.Write([]byte(`{}`))
+		case r.Method == "POST" && r.URL.Path == "/_matrix/client/r0/rooms/!room:localhost/kick":
+			request := &api.KickRequest{}
+			json.NewDecoder(r.Body).Decode(request)
+			if request.UserId != "@dave:localhost" {
+				t.Errorf("unexpected kick: %s", request.UserId)
+			}
+			w.Write([]byte(`{}`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestUnitRoomRead_singleStateRequest(t *testing.T) {
+	requests := make(map[string]int)
+	server := testUnitRoomStateServer(t, requests)
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceRoom().Schema, map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+	})
+	d.SetId("!room:localhost")
+	meta := Metadata{ClientApiUrl: server.URL}
+
+	exists, err := resourceRoomExists(d, meta)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if !exists {
+		t.Errorf("expected the room to exist")
+	}
+
+	err = resourceRoomRead(d, meta)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	if len(requests) != 2 || requests["GET /_matrix/client/r0/joined_rooms"] != 1 || requests["GET /_matrix/client/r0/rooms/!room:localhost/state"] != 1 {
+		t.Errorf("unexpected requests: %#v", requests)
+	}
+
+	expected := map[string]string{
+		"name":                "Sample",
+		"topic":               "This is a topic",
+		"avatar_mxc":          "mxc://localhost/AvatarHere",
+		"creator_user_id":     "@alice:localhost",
+		"room_version":        "5",
+		"guests_allowed":      "true",
+		"replacement_room_id": "",
+	}
+	for k, v := range expected {
+		if fmt.Sprintf("%v", d.Get(k)) != v {
+			t.Errorf("unexpected %s. expected: %s  got: %v", k, v, d.Get(k))
+		}
+	}
+	if d.Get("server_acl.0.allow_ip_literals").(bool) || d.Get("server_acl.0.deny.#").(int) != 1 {
+		t.Errorf("unexpected server_acl: %#v", d.Get("server_acl"))
+	}
+}
+
+func TestUnitRoomRead_keepsAcceptedInvites(t *testing.T) {
+	requests := make(map[string]int)
+	server := testUnitRoomStateServer(t, requests)
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceRoom().Schema, map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+		"invite_user_ids":     []interface{}{"@bob:remote.example.org", "@carol:localhost", "@dave:localhost"},
+	})
+	d.SetId("!room:localhost")
+
+	err := resourceRoomRead(d, Metadata{ClientApiUrl: server.URL})
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+
+	// Bob accepted their invite and Carol's was rescinded, while Dave's invite is pending
+	invited := setOfStrings(d.Get("invite_user_ids").(*schema.Set))
+	sort.Strings(invited)
+	if !reflect.DeepEqual(invited, []string{"@bob:remote.example.org", "@dave:localhost"}) {
+		t.Errorf("unexpected invite_user_ids: %#v", invited)
+	}
+}
+
+func TestUnitRoomExists_notJoined(t *testing.T) {
+	requests := make(map[string]int)
+	server := testUnitRoomStateServer(t, requests)
+	defer server.Close()
+
+	d := schema.TestResourceDataRaw(t, resourceRoom().Schema, map[string]interface{}{
+		"room_id":             "!missing:localhost",
+		"member_access_token": "member_token",
+	})
+	d.SetId("!missing:localhost")
+
+	exists, err := resourceRoomExists(d, Metadata{ClientApiUrl: server.URL})
+	if err == nil {
+		t.Errorf("expected an error")
+	}
+	if exists {
+		t.Errorf("expected the room to not exist")
+	}
+}
+
+func TestUnitRoomCustomizeDiff_serverAclChecksMemberServer(t *testing.T) {
+	whoamiTokens := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.Path != "/_matrix/client/r0/account/whoami" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		whoamiTokens = append(whoamiTokens, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"user_id":"@bob:remote.example.org"}`))
+	}))
+	defer server.Close()
+
+	// The creator's server is allowed, but the member managing the room is on the denied server
+	rawConfig, err := config.NewRawConfig(map[string]interface{}{
+		"creator_user_id":     "@alice:localhost",
+		"member_access_token": "bob_token",
+		"server_acl": []interface{}{
+			map[string]interface{}{
+				"allow": []interface{}{"*"},
+				"deny":  []interface{}{"remote.example.org"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = resourceRoom().Diff(nil, terraform.NewResourceConfig(rawConfig), Metadata{ClientApiUrl: server.URL})
+	if err == nil || !strings.Contains(err.Error(), "server_acl would lock remote.example.org out of the room") {
+		t.Errorf("expected a lockout error, got: %v", err)
+	}
+	if !reflect.DeepEqual(whoamiTokens, []string{"Bearer bob_token"}) {
+		t.Errorf("expected a whoami with the member access token, got: %#v", whoamiTokens)
+	}
+}
+
+func TestUnitRoomUpdate_resetsManagedServerAcl(t *testing.T) {
+	var aclRequest *api.RoomServerAclEventContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/_matrix/client/r0/rooms/!room:localhost/state/m.room.server_acl":
+			aclRequest = &api.RoomServerAclEventContent{}
+			json.NewDecoder(r.Body).Decode(aclRequest)
+			w.Write([]byte(`{"event_id":"$acl"}`))
+		case r.Method == "GET" && r.URL.Path == "/_matrix/client/r0/rooms/!room:localhost/state":
+			w.Write([]byte(`[
+				{"type":"m.room.create","state_key":"","content":{"creator":"@alice:localhost","room_version":"5"}},
+				{"type":"m.room.member","state_key":"@alice:localhost","content":{"membership":"join"}},
+				{"type":"m.room.server_acl","state_key":"","content":{"allow":["*"],"deny":[],"allow_ip_literals":true}}
+			]`))
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	meta := Metadata{ClientApiUrl: server.URL}
+
+	allowHash := strconv.Itoa(hashServerAclGlob("*"))
+	denyHash := strconv.Itoa(hashServerAclGlob("evil.example.org"))
+	state := &terraform.InstanceState{
+		ID: "!room:localhost",
+		Attributes: map[string]string{
+			"room_id":                         "!room:localhost",
+			"member_access_token":             "member_token",
+			"creator_user_id":                 "@alice:localhost",
+			"room_version":                    "5",
+			"server_acl.#":                    "1",
+			"server_acl.0.allow.#":            "1",
+			"server_acl.0.allow." + allowHash: "*",
+			"server_acl.0.deny.#":             "1",
+			"server_acl.0.deny." + denyHash:   "evil.example.org",
+			"server_acl.0.allow_ip_literals":  "true",
+			"server_acl_managed":              "true",
+		},
+	}
+	rawConfig, err := config.NewRawConfig(map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+		"server_acl":          []interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := resourceRoom().Diff(state, terraform.NewResourceConfig(rawConfig), meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff == nil || diff.RequiresNew() {
+		t.Fatalf("expected an in-place update, got: %#v", diff)
+	}
+
+	newState, err := resourceRoom().Apply(state, diff, meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if aclRequest == nil || !reflect.DeepEqual(aclRequest.Allow, []string{"*"}) || len(aclRequest.Deny) != 0 {
+		t.Errorf("expected an ACL allowing everyone, got: %#v", aclRequest)
+	}
+	if newState.Attributes["server_acl.#"] != "0" && newState.Attributes["server_acl.#"] != "" {
+		t.Errorf("expected the server_acl to be removed from state, got: %#v", newState.Attributes)
+	}
+	if newState.Attributes["server_acl_managed"] != "false" {
+		t.Errorf("expected the server_acl to no longer be managed, got: %#v", newState.Attributes)
+	}
+}
+
+func TestUnitRoomDiff_unmanagedServerAclIsLeftAlone(t *testing.T) {
+	allowHash := strconv.Itoa(hashServerAclGlob("*"))
+	denyHash := strconv.Itoa(hashServerAclGlob("evil.example.org"))
+	state := &terraform.InstanceState{
+		ID: "!room:localhost",
+		Attributes: map[string]string{
+			"room_id":                         "!room:localhost",
+			"member_access_token":             "member_token",
+			"creator_user_id":                 "@alice:localhost",
+			"room_version":                    "5",
+			"server_acl.#":                    "1",
+			"server_acl.0.allow.#":            "1",
+			"server_acl.0.allow." + allowHash: "*",
+			"server_acl.0.deny.#":             "1",
+			"server_acl.0.deny." + denyHash:   "evil.example.org",
+			"server_acl.0.allow_ip_literals":  "true",
+			"server_acl_managed":              "false",
+		},
+	}
+
+	// Leaving the server_acl out keeps the room's ACL
+	rawConfig, err := config.NewRawConfig(map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff, err := resourceRoom().Diff(state, terraform.NewResourceConfig(rawConfig), Metadata{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff != nil {
+		for k := range diff.Attributes {
+			if strings.HasPrefix(k, "server_acl") {
+				t.Errorf("expected no server_acl diff, got: %#v", diff.Attributes[k])
+			}
+		}
+	}
+
+	// Resetting an ACL which Terraform didn't set is refused
+	rawConfig, err = config.NewRawConfig(map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+		"server_acl":          []interface{}{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = resourceRoom().Diff(state, terraform.NewResourceConfig(rawConfig), Metadata{})
+	if err == nil || !strings.Contains(err.Error(), "not set by Terraform") {
+		t.Errorf("expected an error about the unmanaged ACL, got: %v", err)
+	}
+}
+
+
+func TestUnitRoomUpdate_removedInvitesAreRescinded(t *testing.T) {
+	requests := make(map[string]int)
+	server := testUnitRoomStateServer(t, requests)
+	defer server.Close()
+	meta := Metadata{ClientApiUrl: server.URL}
+
+	inviteHash := strconv.Itoa(schema.HashSchema(&schema.Schema{Type: schema.TypeString})("@dave:localhost"))
+	state := &terraform.InstanceState{
+		ID: "!room:localhost",
+		Attributes: map[string]string{
+			"room_id":                       "!room:localhost",
+			"member_access_token":           "member_token",
+			"creator_user_id":               "@alice:localhost",
+			"room_version":                  "5",
+			"invite_user_ids.#":             "1",
+			"invite_user_ids." + inviteHash: "@dave:localhost",
+		},
+	}
+	rawConfig, err := config.NewRawConfig(map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := resourceRoom().Diff(state, terraform.NewResourceConfig(rawConfig), meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff == nil || diff.RequiresNew() {
+		t.Fatalf("expected an in-place update, got: %#v", diff)
+	}
+
+	_, err = resourceRoom().Apply(state, diff, meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Dave is the only one invited, so their invite is the one rescinded
+	if requests["POST /_matrix/client/r0/rooms/!room:localhost/kick"] != 1 {
+		t.Errorf("expected Dave's invite to be rescinded, got requests: %#v", requests)
+	}
+}
+
+func TestUnitRoomCreate_adoptedRoomSendsInvites(t *testing.T) {
+	requests := make(map[string]int)
+	server := testUnitRoomStateServer(t, requests)
+	defer server.Close()
+	meta := Metadata{ClientApiUrl: server.URL}
+
+	rawConfig, err := config.NewRawConfig(map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "member_token",
+		"invite_user_ids":     []interface{}{"@bob:remote.example.org", "@dave:localhost", "@erin:localhost"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := resourceRoom().Diff(nil, terraform.NewResourceConfig(rawConfig), meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	newState, err := resourceRoom().Apply(nil, diff, meta)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Bob has joined and Dave is already invited, so only Erin needs an invite
+	if requests["POST /_matrix/client/r0/rooms/!room:localhost/invite"] != 1 {
+		t.Errorf("expected Erin to be invited, got requests: %#v", requests)
+	}
+	// Erin's invite isn't in the fake room's state, so it is the only one missing
+	if newState.Attributes["invite_user_ids.#"] != "2" {
+		t.Errorf("unexpected invite_user_ids: %#v", newState.Attributes)
+	}
+}
+
+func TestUnitRoomImport_derivesCreationSettings(t *testing.T) {
+	cases := []struct {
+		joinRule       string
+		alias          string
+		preset         string
+		aliasLocalpart string
+	}{
+		{"public", "#myroom:localhost", "public_chat", "myroom"},
+		// Private and trusted private chats can't be told apart
+		{"invite", "#myroom:localhost", "", "myroom"},
+		// Aliases on other servers weren't created with the room
+		{"public", "#myroom:remote.example.org", "public_chat", ""},
+	}
+
+	for _, c := range cases {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "GET" && r.URL.Path == "/_matrix/client/r0/rooms/!room:localhost/state":
+				fmt.Fprintf(w, `[
+					{"type":"m.room.create","state_key":"","content":{"creator":"@alice:localhost","room_version":"5"}},
+					{"type":"m.room.member","state_key":"@alice:localhost","content":{"membership":"join"}},
+					{"type":"m.room.member","state_key":"@bob:localhost","content":{"membership":"invite"}},
+					{"type":"m.room.join_rules","state_key":"","content":{"join_rule":"%s"}},
+					{"type":"m.room.canonical_alias","state_key":"","content":{"alias":"%s"}}
+				]`, c.joinRule, c.alias)
+			case r.Method == "GET" && r.URL.Path == "/_matrix/client/r0/account/whoami":
+				w.Write([]byte(`{"user_id":"@alice:localhost"}`))
+			default:
+				t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+
+		d := resourceRoom().Data(&terraform.InstanceState{ID: "!room:localhost"})
+		imported, err := resourceRoomImport(d, Metadata{ClientApiUrl: server.URL, DefaultAccessToken: "default_token"})
+		server.Close()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		d = imported[0]
+		if d.Get("preset").(string) != c.preset {
+			t.Errorf("%s %s: unexpected preset: %s", c.joinRule, c.alias, d.Get("preset"))
+		}
+		if d.Get("local_alias_localpart").(string) != c.aliasLocalpart {
+			t.Errorf("%s %s: unexpected local_alias_localpart: %s", c.joinRule, c.alias, d.Get("local_alias_localpart"))
+		}
+		invited := setOfStrings(d.Get("invite_user_ids").(*schema.Set))
+		if !reflect.DeepEqual(invited, []string{"@bob:localhost"}) {
+			t.Errorf("%s %s: unexpected invite_user_ids: %#v", c.joinRule, c.alias, invited)
+		}
+	}
+}
+
+func TestUnitRoomDiff_importedCreationSettingsLeftOut(t *testing.T) {
+	state := &terraform.InstanceState{
+		ID: "!room:localhost",
+		Attributes: map[string]string{
+			"room_id":               "!room:localhost",
+			"member_access_token":   "default_token",
+			"creator_user_id":       "@alice:localhost",
+			"room_version":          "5",
+			"preset":                "public_chat",
+			"local_alias_localpart": "myroom",
+		},
+	}
+	rawConfig, err := config.NewRawConfig(map[string]interface{}{
+		"room_id":             "!room:localhost",
+		"member_access_token": "default_token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := resourceRoom().Diff(state, terraform.NewResourceConfig(rawConfig), Metadata{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if diff != nil && diff.RequiresNew() {
+		t.Errorf("expected the room to be kept, got: %#v", diff)
+	}
+}
+
+func testAccCheckMatrixRoomStateContent(n string, eventType string, stateKey string, expected map[string]interface{}) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		meta := testAccProvider.Meta().(Metadata)
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("not found: %s", n)
+		}
+
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("record id not set")
+		}
+
+		state, err := getRoomState(meta, rs.Primary.ID, rs.Primary.Attributes["member_access_token"])
+		if err != nil {
+			return err
+		}
+
+		content := make(map[string]interface{})
+		found, err := state.get(eventType, stateKey, &content)
+		if err != nil {
+			return err
+		}
+		if !found {
+			return fmt.Errorf("state event %s (%s) not found", eventType, stateKey)
+		}
+		if !reflect.DeepEqual(content, expected) {
+			return fmt.Errorf("state event content mismatch. expected: %#v  got: %#v", expected, content)
+		}
+
+		return nil
+	}
+}
+
+func TestUnitRoomDiff_roomIdAfterSeveralUpgrades(t *testing.T) {
+	state := &terraform.InstanceState{
+		ID: "!third:localhost",
+		Attributes: map[string]string{
+			"room_id":             "!third:localhost",
+			"member_access_token": "member_token",
+			"creator_user_id":     "@alice:localhost",
+			"room_version":        "5",
+			"predecessor_room_id": "!second:localhost",
+			"previous_room_ids.#": "2",
+			"previous_room_ids.0": "!first:localhost",
+			"previous_room_ids.1": "!second:localhost",
+		},
+	}
+
+	cases := []struct {
+		roomId      string
+		requiresNew bool
+	}{
+		{"!first:localhost", false},
+		{"!second:localhost", false},
+		{"!third:localhost", false},
+		{"!other:localhost", true},
+	}
+	for _, c := range cases {
+		rawConfig, err := config.NewRawConfig(map[string]interface{}{
+			"room_id":             c.roomId,
+			"member_access_token": "member_token",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		diff, err := resourceRoom().Diff(state, terraform.NewResourceConfig(rawConfig), Metadata{})
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", c.roomId, err)
+		}
+		if requiresNew := diff != nil && diff.RequiresNew(); requiresNew != c.requiresNew {
+			t.Errorf("room_id %s: expected requiresNew=%t, got %#v", c.roomId, c.requiresNew, diff)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package matrix
+
+import (
+	"github.com/hashicorp/terraform/helper/schema"
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"net/http"
+)
+
+func resourceSpaceChild() *schema.Resource {
+	return &schema.Resource{
+		Create: resourceSpaceChildCreate,
+		Read:   resourceSpaceChildRead,
+		Update: resourceSpaceChildUpdate,
+		Delete: resourceSpaceChildDelete,
+
+		Schema: map[string]*schema.Schema{
+			"space_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"child_room_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"member_access_token": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"via": {
+				Type: schema.TypeList,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+				Optional: true,
+				Computed: true,
+				// Defaults to the child room's server
+			},
+			"order": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"suggested": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"set_parent": {
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"canonical": {
+				Type:     schema.TypeBool,
+				Optional: true,
+				// Ignored unless set_parent is true
+			},
+			"child_access_token": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// Defaults to the member_access_token. Only used when set_parent is true
+			},
+		},
+	}
+}
+
+func resourceSpaceChildCreate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	spaceId := d.Get("space_id").(string)
+	childRoomId := d.Get("child_room_id").(string)
+
+	err := resourceSpaceChildSendChild(d, meta, false)
+	if err != nil {
+		return err
+	}
+
+	if d.Get("set_parent").(bool) {
+		err = resourceSpaceChildSendParent(d, meta, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	d.SetId(fmt.Sprintf("%s/%s", spaceId, childRoomId))
+	return resourceSpaceChildRead(d, meta)
+}
+
+func resourceSpaceChildRead(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	memberAccessToken := d.Get("member_access_token").(string)
+	spaceId := d.Get("space_id").(string)
+	childRoomId := d.Get("child_room_id").(string)
+
+	childResponse := &api.SpaceChildEventContent{}
+	urlStr := makeStateEventUrl(meta.ClientApiUrl, spaceId, "m.space.child", childRoomId)
+	log.Println("[DEBUG] Getting space child:", urlStr)
+	err := api.DoRequest("GET", urlStr, nil, childResponse, memberAccessToken)
+	if err != nil {
+		if r, ok := err.(*api.ErrorResponse); !ok || r.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("error getting space child: %s", err)
+		}
+	}
+	if len(childResponse.Via) == 0 {
+		// A child without any servers to join through is considered removed from the space
+		log.Println("[DEBUG] Space child has no via servers, considering it deleted")
+		d.SetId("")
+		return nil
+	}
+
+	d.Set("via", childResponse.Via)
+	d.Set("order", childResponse.Order)
+	d.Set("suggested", childResponse.Suggested)
+
+	if d.Get("set_parent").(bool) {
+		parentResponse := &api.SpaceParentEventContent{}
+		urlStr = makeStateEventUrl(meta.ClientApiUrl, childRoomId, "m.space.parent", spaceId)
+		log.Println("[DEBUG] Getting space parent:", urlStr)
+		err = api.DoRequest("GET", urlStr, nil, parentResponse, resourceSpaceChildChildToken(d))
+		if err != nil {
+			if r, ok := err.(*api.ErrorResponse); !ok || r.StatusCode != http.StatusNotFound {
+				return fmt.Errorf("error getting space parent: %s", err)
+			}
+		}
+
+		d.Set("set_parent", len(parentResponse.Via) > 0)
+		d.Set("canonical", parentResponse.Canonical)
+	}
+
+	return nil
+}
+
+func resourceSpaceChildUpdate(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	if d.HasChange("via") || d.HasChange("order") || d.HasChange("suggested") {
+		err := resourceSpaceChildSendChild(d, meta, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("set_parent") || d.HasChange("canonical") || d.HasChange("via") {
+		setParent := d.Get("set_parent").(bool)
+		if setParent || d.HasChange("set_parent") {
+			err := resourceSpaceChildSendParent(d, meta, !setParent)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return resourceSpaceChildRead(d, meta)
+}
+
+func resourceSpaceChildDelete(d *schema.ResourceData, m interface{}) error {
+	meta := m.(Metadata)
+
+	// Relations are removed by sending empty content
+	if d.Get("set_parent").(bool) {
+		err := resourceSpaceChildSendParent(d, meta, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return resourceSpaceChildSendChild(d, meta, true)
+}
+
+func resourceSpaceChildSendChild(d *schema.ResourceData, meta Metadata, remove bool) error {
+	memberAccessToken := d.Get("member_access_token").(string)
+	spaceId := d.Get("space_id").(string)
+	childRoomId := d.Get("child_room_id").(string)
+
+	request := &api.SpaceChildEventContent{}
+	if !remove {
+		via, err := resourceSpaceChildVia(d)
+		if err != nil {
+			return err
+		}
+
+		request.Via = via
+		request.Order = d.Get("order").(string)
+		request.Suggested = d.Get("suggested").(bool)
+	}
+
+	response := &api.EventIdResponse{}
+	urlStr := makeStateEventUrl(meta.ClientApiUrl, spaceId, "m.space.child", childRoomId)
+	log.Println("[DEBUG] Updating space child:", urlStr)
+	err := api.DoRequest("PUT", urlStr, request, response, memberAccessToken)
+	if err != nil {
+		return fmt.Errorf("error updating space child: %s", err)
+	}
+
+	return nil
+}
+
+func resourceSpaceChildSendParent(d *schema.ResourceData, meta Metadata, remove bool) error {
+	spaceId := d.Get("space_id").(string)
+	childRoomId := d.Get("child_room_id").(string)
+
+	request := &api.SpaceParentEventContent{}
+	if !remove {
+		via, err := resourceSpaceChildVia(d)
+		if err != nil {
+			return err
+		}
+
+		request.Via = via
+		request.Canonical = d.Get("canonical").(bool)
+	}
+
+	response := &api.EventIdResponse{}
+	urlStr := makeStateEventUrl(meta.ClientApiUrl, childRoomId, "m.space.parent", spaceId)
+	log.Println("[DEBUG] Updating space parent:", urlStr)
+	err := api.DoRequest("PUT", urlStr, request, response, resourceSpaceChildChildToken(d))
+	if err != nil {
+		return fmt.Errorf("error updating space parent: %s", err)
+	}
+
+	return nil
+}
+
+func resourceSpaceChildVia(d *schema.ResourceData) ([]string, error) {
+	via := make([]string, 0)
+	for _, v := range d.Get("via").([]interface{}) {
+		via = append(via, v.(string))
+	}
+
+	if len(via) == 0 {
+		hsDomain, err := getDomainName(d.Get("child_room_id").(string))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing child room id: %s", err)
+		}
+		via = append(via, hsDomain)
+	}
+
+	return via, nil
+}
+
+func resourceSpaceChildChildToken(d *schema.ResourceData) string {
+	childAccessToken := d.Get("child_access_token").(string)
+	if childAccessToken == "" {
+		childAccessToken = d.Get("member_access_token").(string)
+	}
+	return childAccessToken
+}
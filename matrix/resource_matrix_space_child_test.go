@@ -0,0 +1,141 @@
+package matrix
+
+import (
+	"testing"
+	"github.com/hashicorp/terraform/helper/resource"
+	"fmt"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"github.com/hashicorp/terraform/terraform"
+	"net/http"
+)
+
+var testAccMatrixSpaceChildConfig_spaceChild = `
+resource "matrix_room" "space" {
+	creator_user_id = "%s"
+	member_access_token = "%s"
+	name = "Sample Space"
+	room_type = "m.space"
+}
+
+resource "matrix_room" "child" {
+	creator_user_id = "%s"
+	member_access_token = "%s"
+	name = "Sample Child"
+}
+
+resource "matrix_space_child" "foobar" {
+	space_id = "${matrix_room.space.id}"
+	child_room_id = "${matrix_room.child.id}"
+	member_access_token = "%s"
+	order = "%s"
+	suggested = true
+	set_parent = true
+	canonical = true
+}`
+
+func TestAccMatrixSpaceChild_SpaceChild(t *testing.T) {
+	creator := testAccCreateTestUser("test_acc_space_child")
+	config := func(order string) string {
+		return fmt.Sprintf(testAccMatrixSpaceChildConfig_spaceChild, creator.UserId, creator.AccessToken, creator.UserId, creator.AccessToken, creator.AccessToken, order)
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckMatrixSpaceChildDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config("aaa"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixSpaceChildExists("matrix_space_child.foobar"),
+					resource.TestCheckResourceAttr("matrix_room.space", "room_type", "m.space"),
+					resource.TestCheckResourceAttr("matrix_room.child", "room_type", ""),
+					resource.TestCheckResourceAttr("matrix_space_child.foobar", "order", "aaa"),
+					resource.TestCheckResourceAttr("matrix_space_child.foobar", "suggested", "true"),
+					resource.TestCheckResourceAttr("matrix_space_child.foobar", "set_parent", "true"),
+					resource.TestCheckResourceAttr("matrix_space_child.foobar", "canonical", "true"),
+					resource.TestCheckResourceAttr("matrix_space_child.foobar", "via.#", "1"),
+				),
+			},
+			{
+				Config: config("bbb"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckMatrixSpaceChildExists("matrix_space_child.foobar"),
+					resource.TestCheckResourceAttr("matrix_space_child.foobar", "order", "bbb"),
+				),
+			},
+		},
+	})
+}
+
+func testAccCheckMatrixSpaceChildDestroy(s *terraform.State) error {
+	meta := testAccProvider.Meta().(Metadata)
+	for _, rs := range s.RootModule().Resources {
+		if rs.Type != "matrix_space_child" {
+			continue
+		}
+
+		// The rooms are abandoned alongside the relation, so we can only check the relation if we can still see it
+		response := &api.SpaceChildEventContent{}
+		urlStr := makeStateEventUrl(meta.ClientApiUrl, rs.Primary.Attributes["space_id"], "m.space.child", rs.Primary.Attributes["child_room_id"])
+		err := api.DoRequest("GET", urlStr, nil, response, rs.Primary.Attributes["member_access_token"])
+		if err != nil {
+			if r, ok := err.(*api.ErrorResponse); ok && (r.StatusCode == http.StatusForbidden || r.StatusCode == http.StatusNotFound) {
+				continue
+			}
+			return err
+		}
+		if len(response.Via) != 0 {
+			return fmt.Errorf("space child was not removed")
+		}
+	}
+
+	return nil
+}
+
+func testAccCheckMatrixSpaceChildExists(n string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		meta := testAccProvider.Meta().(Metadata)
+		rs, ok := s.RootModule().Resources[n]
+
+		if !ok {
+			return fmt.Errorf("not found: %s", n)
+		}
+
+		if rs.Primary.ID == "" {
+			return fmt.Errorf("record id not set")
+		}
+
+		spaceId := rs.Primary.Attributes["space_id"]
+		childRoomId := rs.Primary.Attributes["child_room_id"]
+		memberAccessToken := rs.Primary.Attributes["member_access_token"]
+
+		childResponse := &api.SpaceChildEventContent{}
+		urlStr := makeStateEventUrl(meta.ClientApiUrl, spaceId, "m.space.child", childRoomId)
+		err := api.DoRequest("GET", urlStr, nil, childResponse, memberAccessToken)
+		if err != nil {
+			return fmt.Errorf("error getting space child: %s", err)
+		}
+		if len(childResponse.Via) == 0 {
+			return fmt.Errorf("space child has no via servers")
+		}
+		if childResponse.Order != rs.Primary.Attributes["order"] {
+			return fmt.Errorf("order mismatch. expected: %s  got: %s", rs.Primary.Attributes["order"], childResponse.Order)
+		}
+
+		parentResponse := &api.SpaceParentEventContent{}
+		urlStr = makeStateEventUrl(meta.ClientApiUrl, childRoomId, "m.space.parent", spaceId)
+		err = api.DoRequest("GET", urlStr, nil, parentResponse, memberAccessToken)
+		if err != nil {
+			return fmt.Errorf("error getting space parent: %s", err)
+		}
+		if len(parentResponse.Via) == 0 {
+			return fmt.Errorf("space parent has no via servers")
+		}
+		if !parentResponse.Canonical {
+			return fmt.Errorf("space parent is not canonical")
+		}
+
+		return nil
+	}
+}
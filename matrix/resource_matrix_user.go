@@ -5,6 +5,7 @@ import (
 	"github.com/turt2live/terraform-provider-matrix/matrix/api"
 	"log"
 	"fmt"
+	"strings"
 )
 
 func resourceUser() *schema.Resource {
@@ -15,6 +16,12 @@ func resourceUser() *schema.Resource {
 		Update: resourceUserUpdate,
 		Delete: resourceUserDelete,
 
+		CustomizeDiff: resourceUserCustomizeDiff,
+
+		Importer: &schema.ResourceImporter{
+			State: resourceUserImport,
+		},
+
 		Schema: map[string]*schema.Schema{
 			"username": {
 				Type:     schema.TypeString,
@@ -42,6 +49,21 @@ func resourceUser() *schema.Resource {
 				Computed: true,
 				Optional: true,
 			},
+			"avatar_file": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				ConflictsWith: []string{"avatar_mxc"},
+				// Uploaded again whenever the file's contents change
+			},
+			"avatar_file_type": {
+				Type:     schema.TypeString,
+				Optional: true,
+				// Defaults to a type based on the file extension
+			},
+			"avatar_file_sha256": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
 		},
 	}
 }
@@ -108,6 +130,14 @@ func resourceUserCreate(d *schema.ResourceData, m interface{}) error {
 		resourceUserSetDisplayName(d, meta, displayNameRaw.(string))
 	}
 
+	if d.Get("avatar_file").(string) != "" {
+		avatarMxc, err := uploadAvatarFile(d, meta, d.Get("access_token").(string))
+		if err != nil {
+			return err
+		}
+		avatarMxcRaw = avatarMxc
+	}
+
 	if avatarMxcRaw != nil {
 		resourceUserSetAvatarMxc(d, meta, avatarMxcRaw.(string))
 	}
@@ -115,6 +145,38 @@ func resourceUserCreate(d *schema.ResourceData, m interface{}) error {
 	return resourceUserRead(d, meta)
 }
 
+func resourceUserCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	return customizeDiffAvatarFile(d)
+}
+
+func resourceUserImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	meta := m.(Metadata)
+
+	// Users are imported as "<user_id>|<access_token>"
+	parts := strings.SplitN(d.Id(), "|", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("expected an import id of the form <user_id>|<access_token>")
+	}
+	userId := parts[0]
+	accessToken := parts[1]
+
+	log.Println("[DEBUG] User whoami")
+	response := &api.WhoAmIResponse{}
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/account/whoami")
+	err := api.DoRequest("GET", urlStr, nil, response, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("error performing whoami: %s", err)
+	}
+	if response.UserId != userId {
+		return nil, fmt.Errorf("access token belongs to %s, not %s", response.UserId, userId)
+	}
+
+	d.SetId(userId)
+	d.Set("access_token", accessToken)
+
+	return []*schema.ResourceData{d}, nil
+}
+
 func resourceUserExists(d *schema.ResourceData, m interface{}) (bool, error) {
 	meta := m.(Metadata)
 
@@ -168,6 +230,13 @@ func resourceUserRead(d *schema.ResourceData, m interface{}) error {
 func resourceUserUpdate(d *schema.ResourceData, m interface{}) error {
 	meta := m.(Metadata)
 
+	if avatarFileChanged(d) {
+		_, err := uploadAvatarFile(d, meta, d.Get("access_token").(string))
+		if err != nil {
+			return err
+		}
+	}
+
 	if d.HasChange("avatar_mxc") {
 		newMxc := d.Get("avatar_mxc").(string)
 		err := resourceUserSetAvatarMxc(d, meta, newMxc)
@@ -7,6 +7,7 @@ import (
 	"github.com/turt2live/terraform-provider-matrix/matrix/api"
 	"github.com/hashicorp/terraform/terraform"
 	"regexp"
+	"path"
 )
 
 type testAccMatrixUser struct {
@@ -234,6 +235,76 @@ func TestAccMatrixUser_UpdateProfile(t *testing.T) {
 	})
 }
 
+var testAccMatrixUserConfig_avatarFile = `
+resource "matrix_user" "foobar" {
+	access_token = "%s"
+	avatar_file = "%s"
+	avatar_file_type = "application/octet-stream"
+}`
+
+func TestAccMatrixUser_AvatarFile(t *testing.T) {
+	testUser := testAccCreateTestUser("test_user_avatar_file")
+	wordsPath := path.Join(testAccTestDataDir(), ".test_data/words.txt")
+	binPath := path.Join(testAccTestDataDir(), ".test_data/deadbeef.bin")
+	var firstMxc string
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		// We don't check if users get destroyed because they aren't
+		//CheckDestroy: testAccCheckMatrixUserDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: fmt.Sprintf(testAccMatrixUserConfig_avatarFile, testUser.AccessToken, wordsPath),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("matrix_user.foobar", "avatar_mxc", regexp.MustCompile("^mxc://")),
+					resource.TestCheckResourceAttr("matrix_user.foobar", "avatar_file_sha256", "35c6b9f66dceb6cf8f733d08689564e420e18eb40250d9435352617c027f36d6"),
+					func(s *terraform.State) error {
+						firstMxc = s.RootModule().Resources["matrix_user.foobar"].Primary.Attributes["avatar_mxc"]
+						return nil
+					},
+				),
+			},
+			{
+				Config: fmt.Sprintf(testAccMatrixUserConfig_avatarFile, testUser.AccessToken, binPath),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestMatchResourceAttr("matrix_user.foobar", "avatar_mxc", regexp.MustCompile("^mxc://")),
+					func(s *terraform.State) error {
+						avatarMxc := s.RootModule().Resources["matrix_user.foobar"].Primary.Attributes["avatar_mxc"]
+						if avatarMxc == firstMxc {
+							return fmt.Errorf("avatar was not uploaded again after the file changed")
+						}
+						return nil
+					},
+				),
+			},
+		},
+	})
+}
+
+func TestAccMatrixUser_Import(t *testing.T) {
+	testUser := testAccCreateTestUser("test_user_import")
+	conf := fmt.Sprintf(testAccMatrixUserConfig_accessToken, testUser.AccessToken)
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:  func() { testAccPreCheck(t) },
+		Providers: testAccProviders,
+		// We don't check if users get destroyed because they aren't
+		//CheckDestroy: testAccCheckMatrixUserDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: conf,
+			},
+			{
+				ResourceName:      "matrix_user.foobar",
+				ImportState:       true,
+				ImportStateId:     fmt.Sprintf("%s|%s", testUser.UserId, testUser.AccessToken),
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
 func testAccCheckMatrixUserExists(n string, user *testAccMatrixUser) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		meta := testAccProvider.Meta().(Metadata)
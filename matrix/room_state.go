@@ -0,0 +1,83 @@
+package matrix
+
+import (
+	"fmt"
+	"log"
+	"github.com/turt2live/terraform-provider-matrix/matrix/api"
+	"encoding/json"
+	"sort"
+)
+
+type roomStateKey struct {
+	EventType string
+	StateKey  string
+}
+
+// roomState is the current state of a room, keyed by event type and state key
+type roomState map[roomStateKey]api.StateEvent
+
+func getRoomState(meta Metadata, roomId string, accessToken string) (roomState, error) {
+	stateEvents := make([]api.StateEvent, 0)
+	urlStr := api.MakeUrl(meta.ClientApiUrl, "/_matrix/client/r0/rooms/", roomId, "/state")
+	log.Println("[DEBUG] Getting room state:", urlStr)
+	err := api.DoRequest("GET", urlStr, nil, &stateEvents, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("error getting room state: %s", err)
+	}
+
+	state := make(roomState)
+	for _, event := range stateEvents {
+		state[roomStateKey{EventType: event.Type, StateKey: event.StateKey}] = event
+	}
+
+	return state, nil
+}
+
+// get parses the content of the given state event into content, returning false if the event is not in the room
+func (s roomState) get(eventType string, stateKey string, content interface{}) (bool, error) {
+	event, ok := s[roomStateKey{EventType: eventType, StateKey: stateKey}]
+	if !ok {
+		return false, nil
+	}
+
+	err := json.Unmarshal(event.Content, content)
+	if err != nil {
+		return true, fmt.Errorf("error parsing %s event: %s", eventType, err)
+	}
+
+	return true, nil
+}
+
+// membership returns the membership of the given user, or "leave" if they have never been in the room
+func (s roomState) membership(userId string) (string, error) {
+	memberContent := &api.RoomMemberEventContent{}
+	found, err := s.get("m.room.member", userId, memberContent)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "leave", nil
+	}
+	return memberContent.Membership, nil
+}
+
+// members returns the sorted user IDs of everyone with the given membership in the room
+func (s roomState) members(membership string) ([]string, error) {
+	userIds := make([]string, 0)
+	for key := range s {
+		if key.EventType != "m.room.member" {
+			continue
+		}
+
+		userMembership, err := s.membership(key.StateKey)
+		if err != nil {
+			return nil, err
+		}
+		if userMembership == membership {
+			userIds = append(userIds, key.StateKey)
+		}
+	}
+
+	sort.Strings(userIds)
+	return userIds, nil
+}
@@ -2,7 +2,13 @@ package matrix
 
 import (
 	"strings"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"path"
+	"net"
+	"github.com/hashicorp/terraform/helper/hashcode"
 	"github.com/hashicorp/terraform/helper/schema"
 )
 
@@ -36,6 +42,14 @@ func stripMxc(input string) (string, string, string, error) {
 	return constructed, origin, mediaId, nil
 }
 
+func validateMxc(v interface{}, k string) ([]string, []error) {
+	_, _, _, err := stripMxc(v.(string))
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s is not a valid mxc URI: %s", k, err)}
+	}
+	return nil, nil
+}
+
 func setOfStrings(val *schema.Set) []string {
 	res := make([]string, 0)
 
@@ -60,3 +74,72 @@ func getDomainName(identifier string) (string, error) {
 
 	return hsDomain, nil
 }
+
+func matchesAnyPattern(val string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, val); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeServerAclGlob(glob string) string {
+	return strings.ToLower(strings.TrimSpace(glob))
+}
+
+func hashServerAclGlob(val interface{}) int {
+	return hashcode.String(normalizeServerAclGlob(val.(string)))
+}
+
+func getServerNameHost(serverName string) string {
+	if strings.HasPrefix(serverName, "[") {
+		// IPv6 literal, optionally with a port
+		end := strings.Index(serverName, "]")
+		if end > 0 {
+			return serverName[:end+1]
+		}
+		return serverName
+	}
+	return strings.Split(serverName, ":")[0]
+}
+
+func serverAclAllowsServer(allow []string, deny []string, allowIpLiterals bool, serverName string) bool {
+	host := strings.ToLower(getServerNameHost(serverName))
+
+	if !allowIpLiterals {
+		if strings.HasPrefix(host, "[") || net.ParseIP(host) != nil {
+			return false
+		}
+	}
+
+	normalizedDeny := make([]string, 0)
+	for _, glob := range deny {
+		normalizedDeny = append(normalizedDeny, normalizeServerAclGlob(glob))
+	}
+	if matchesAnyPattern(host, normalizedDeny) {
+		return false
+	}
+
+	normalizedAllow := make([]string, 0)
+	for _, glob := range allow {
+		normalizedAllow = append(normalizedAllow, normalizeServerAclGlob(glob))
+	}
+	return matchesAnyPattern(host, normalizedAllow)
+}
+
+// makeNonce generates a random hex string, used to keep transaction IDs unique to a resource
+func makeNonce() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", fmt.Errorf("error generating nonce: %s", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// makeTxnId builds a transaction ID from the given parts so that retried sends are deduplicated by the server
+func makeTxnId(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return "tf" + hex.EncodeToString(hash[:16])
+}
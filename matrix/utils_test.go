@@ -247,3 +247,75 @@ func TestUnitUtilsGetDomainName_errorWhenInvalid(t *testing.T) {
 		t.Errorf("expected an error, but got a result")
 	}
 }
+
+func TestUnitUtilsMatchesAnyPattern_exactMatch(t *testing.T) {
+	if !matchesAnyPattern("@user:domain.com", []string{"@other:domain.com", "@user:domain.com"}) {
+		t.Errorf("expected a match")
+	}
+}
+
+func TestUnitUtilsMatchesAnyPattern_globMatch(t *testing.T) {
+	if !matchesAnyPattern("@some_bot:domain.com", []string{"@*bot:domain.com"}) {
+		t.Errorf("expected a match")
+	}
+}
+
+func TestUnitUtilsMatchesAnyPattern_noMatch(t *testing.T) {
+	if matchesAnyPattern("@user:domain.com", []string{"@*bot:domain.com", "@user:other.com"}) {
+		t.Errorf("unexpected match")
+	}
+}
+
+func TestUnitUtilsMatchesAnyPattern_noPatterns(t *testing.T) {
+	if matchesAnyPattern("@user:domain.com", nil) {
+		t.Errorf("unexpected match")
+	}
+}
+
+func TestUnitUtilsNormalizeServerAclGlob_lowercasesAndTrims(t *testing.T) {
+	result := normalizeServerAclGlob("  *.Example.COM ")
+	if result != "*.example.com" {
+		t.Errorf("expected: %s  got: %s", "*.example.com", result)
+	}
+}
+
+func TestUnitUtilsGetServerNameHost_stripsPort(t *testing.T) {
+	result := getServerNameHost("domain.com:8448")
+	if result != "domain.com" {
+		t.Errorf("expected: %s  got: %s", "domain.com", result)
+	}
+}
+
+func TestUnitUtilsGetServerNameHost_ipv6Literal(t *testing.T) {
+	result := getServerNameHost("[::1]:8448")
+	if result != "[::1]" {
+		t.Errorf("expected: %s  got: %s", "[::1]", result)
+	}
+}
+
+func TestUnitUtilsServerAclAllowsServer_allowedByGlob(t *testing.T) {
+	if !serverAclAllowsServer([]string{"*.domain.com", "Domain.com"}, []string{}, true, "domain.com:8448") {
+		t.Errorf("expected server to be allowed")
+	}
+}
+
+func TestUnitUtilsServerAclAllowsServer_notInAllowList(t *testing.T) {
+	if serverAclAllowsServer([]string{"other.com"}, []string{}, true, "domain.com") {
+		t.Errorf("expected server to be denied")
+	}
+}
+
+func TestUnitUtilsServerAclAllowsServer_denyWins(t *testing.T) {
+	if serverAclAllowsServer([]string{"*"}, []string{"*.com"}, true, "domain.com") {
+		t.Errorf("expected server to be denied")
+	}
+}
+
+func TestUnitUtilsServerAclAllowsServer_ipLiterals(t *testing.T) {
+	if serverAclAllowsServer([]string{"*"}, []string{}, false, "127.0.0.1:8448") {
+		t.Errorf("expected ip literal to be denied")
+	}
+	if !serverAclAllowsServer([]string{"*"}, []string{}, true, "127.0.0.1:8448") {
+		t.Errorf("expected ip literal to be allowed")
+	}
+}